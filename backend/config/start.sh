@@ -51,6 +51,7 @@ kctl apply -f db-volume-claim.yaml
 kctl apply -f database-deployment.yaml
 kctl apply -f lobby-deployment.yaml
 kctl apply -f cleanup-deployment.yaml
+kctl apply -f ai-deployment.yaml
 kctl apply -f setup-deployment.yaml
 kctl apply -f gameplay-deployment.yaml
 
@@ -0,0 +1,114 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+
+import (
+    "errors"
+    "fmt"
+    "linegames/backend/internal/ai"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/gameplay"
+    "linegames/backend/internal/rules"
+    "log"
+    "math/rand"
+    "sync"
+    "time"
+)
+
+const (
+    avgPauseMillis = 1000  // Look for games awaiting AI moves every second
+)
+
+// Plays the next turn of `game`, which is expected to belong to an AI seat
+func playTurn(store database.Store, game Game) error {
+    // Timeouts and seats out of play may have moved the turn on
+    if err := gameplay.EnforceClock(store, game); err != nil {
+        return err
+    }
+    board, err := gameplay.CurrentBoard(store, game)
+    if err != nil {
+        return err
+    }
+    if board.GameOver() {
+        // The result will be recorded by whoever played the final move
+        return nil
+    }
+    seat, found, err := store.GetSeat(game.ID, board.Player())
+    if err != nil {
+        return err
+    } else if !found {
+        return fmt.Errorf("Seat %d of game %d not found.", board.Player(), game.ID)
+    } else if seat.Type != AI {
+        return nil
+    }
+    choice, err := ai.ForDifficulty(seat.Difficulty).ChooseMove(board)
+    if err != nil {
+        return err
+    }
+
+    var move Move
+    move.GameID = game.ID
+    move.Turn = board.Turn
+    move.X = choice.X
+    move.Y = choice.Y
+    _, err = gameplay.SubmitMove(store, game, &move)
+    if errors.Is(err, rules.ErrGameOver) {
+        // The game ended off the board, by resignation or agreement
+        return nil
+    }
+    return err
+}
+
+// The games whose turns are being played. Each turn runs on its own goroutine
+//  so that a slow AI (Expert searches for up to two seconds) only holds up its
+//  own game, and a game is skipped until its turn finishes so that it never
+//  has two searches at once.
+type inFlight struct {
+    lock sync.Mutex
+    games map[ID]bool
+}
+
+// Returns false if the game's turn is already being played
+func (f *inFlight) start(gameID ID) bool {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+    if f.games[gameID] {
+        return false
+    }
+    f.games[gameID] = true
+    return true
+}
+
+func (f *inFlight) finish(gameID ID) {
+    f.lock.Lock()
+    defer f.lock.Unlock()
+    delete(f.games, gameID)
+}
+
+func main() {
+    store := database.NewPostgresStore()
+    playing := &inFlight{games: make(map[ID]bool)}
+    for {
+        // Wait some amount between 0.5 and 1.5 times the average pause
+        time.Sleep(time.Millisecond * time.Duration(avgPauseMillis / 2 + rand.Int31n(avgPauseMillis + 1)))
+
+        games, err := store.GetGamesAwaitingAI()
+        if err != nil {
+            log.Printf("Error getting games awaiting AI moves: %s", err.Error())
+            continue
+        }
+        for i := 0; i < len(games); i++ {
+            game := games[i]
+            if !playing.start(game.ID) {
+                continue
+            }
+            go func() {
+                defer playing.finish(game.ID)
+                if err := playTurn(store, game); err != nil {
+                    log.Printf("Error playing AI turn in game %d: %s", game.ID, err.Error())
+                }
+            }()
+        }
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    . "linegames/backend/internal/types"
+    "linegames/backend/internal/gameplay"
+    "linegames/backend/internal/memstore"
+    "linegames/backend/internal/rules"
+    "testing"
+    "time"
+)
+
+const testGameID = 100
+
+// Stores a begun tic-tac-toe game with a claimed seat of each type
+func newTestGame(t *testing.T, tc TimeControl, begunAgo int, seatTypes ...SeatType) (*memstore.MemoryStore, Game) {
+    game := Game{ID: testGameID, Name: "test", NumPlayers: len(seatTypes), Begun: true,
+                 BegunAt: Time(time.Now().Unix()) - Time(begunAgo)}
+    spec := Spec{GameID: testGameID}
+    spec.Spec.Board = GameBoard{Width: 3, Height: 3}
+    spec.Spec.Rules = GameRules{WinningLength: 3}
+    spec.Spec.Clock = tc
+
+    players := make([]Player, len(seatTypes))
+    seats := make([]Seat, len(seatTypes))
+    for i, seatType := range seatTypes {
+        players[i] = Player{ID: 200 + ID(i), GameID: testGameID}
+        seats[i] = Seat{GameID: testGameID, PlayerID: 200 + ID(i), Seat: i, Type: seatType, Claimed: true,
+                        Difficulty: Medium}
+    }
+    store := memstore.New()
+    if err := store.CreateGame(&game, &spec, players, seats); err != nil {
+        t.Fatalf("Could not create test game: %v", err)
+    }
+    return store, game
+}
+
+func TestPlayTurn(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, Human, AI)
+
+    // Not the AI's turn yet
+    if err := playTurn(store, game); err != nil {
+        t.Fatalf("playTurn failed: %v", err)
+    }
+    if moves, _ := store.GetAllMoves(game.ID); len(moves) != 0 {
+        t.Fatalf("Expected no move for the human seat, got %+v", moves)
+    }
+
+    gameplay.SubmitMove(store, game, &Move{GameID: game.ID, Turn: 0, X: 1, Y: 1})
+    if err := playTurn(store, game); err != nil {
+        t.Fatalf("playTurn failed: %v", err)
+    }
+    move, found, _ := store.GetMove(game.ID, 1)
+    if !found || rules.IsPass(move) || (move.X == 1 && move.Y == 1) {
+        t.Fatalf("Expected a legal AI move for turn 1, got %t %+v", found, move)
+    }
+
+    // Playing again, as a second look at the same game would, changes nothing
+    if err := playTurn(store, game); err != nil {
+        t.Fatalf("playTurn failed: %v", err)
+    }
+    if moves, _ := store.GetAllMoves(game.ID); len(moves) != 2 {
+        t.Errorf("Expected the AI to play its turn once, got %+v", moves)
+    }
+}
+
+func TestPlayTurnAfterTimeout(t *testing.T) {
+    // The human seat's 30 seconds ran out 15 seconds ago
+    store, game := newTestGame(t, TimeControl{PerMove: 30, OnTimeout: SkipTurn}, 45, Human, AI)
+
+    if err := playTurn(store, game); err != nil {
+        t.Fatalf("playTurn failed: %v", err)
+    }
+    if move, found, _ := store.GetMove(game.ID, 0); !found || !rules.IsPass(move) {
+        t.Errorf("Expected the human seat's turn to be skipped, got %t %+v", found, move)
+    }
+    if move, found, _ := store.GetMove(game.ID, 1); !found || rules.IsPass(move) {
+        t.Errorf("Expected the AI to play turn 1, got %t %+v", found, move)
+    }
+}
+
+func TestPlayTurnAfterResult(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, AI, Human)
+
+    if err := gameplay.TakeAction(store, game, 1, Resign); err != nil {
+        t.Fatalf("Expected the resignation to be stored, got %v", err)
+    }
+    if err := playTurn(store, game); err != nil {
+        t.Errorf("Expected playTurn to leave the finished game alone, got %v", err)
+    }
+    if _, found, _ := store.GetMove(game.ID, 0); found {
+        t.Errorf("AI moved after the result")
+    }
+}
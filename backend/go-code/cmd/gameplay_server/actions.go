@@ -0,0 +1,138 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "errors"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/gameplay"
+    "linegames/backend/internal/httpparse"
+    "linegames/backend/internal/rules"
+    "net/http"
+)
+
+// `Action` is a types.ActionType: 0 resigns, 1 offers a draw, 2 or 3 accepts
+//  or declines another seat's offer, and 4 abandons the seat to an AI
+type GameActionRequest struct {
+    GameID ID         `json:"gameID"`
+    PlayerID ID       `json:"playerID"`
+    Action ActionType `json:"action"`
+}
+// `Result` shows whether the action ended the game
+type GameActionResponse struct {
+    Success bool      `json:"success"`
+    Result GameResult `json:"result"`
+}
+// `Since` is the ID of the last action the client has seen, or 0 for all
+type GameActionsRequest struct {
+    GameID ID   `url:"gameID"`
+    PlayerID ID `url:"playerID"`
+    Since int   `url:"since"`
+}
+type ActionEvent struct {
+    ID uint           `json:"id"`
+    Seat int          `json:"seat"`
+    Action ActionType `json:"action"`
+    Turn int          `json:"turn"`
+}
+type GameActionsResponse struct {
+    Actions []ActionEvent `json:"actions"`
+}
+
+// Expects a POST request
+func (s *server) gameActionHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(GameActionRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    playerSeat, found, err := s.store.GetPlayerSeat(request.PlayerID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player's seat")
+        return
+    }
+    if playerSeat.Type == AI {
+        apierror.Write(w, apierror.BadRequest, "AI seats do not resign or agree to draws")
+        return
+    }
+    game, found, err := s.store.GetGame(request.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    err = gameplay.TakeAction(s.store, game, playerSeat.Seat, request.Action)
+    if errors.Is(err, rules.ErrGameOver) {
+        apierror.Write(w, apierror.GameOver, err.Error())
+        return
+    } else if gameplay.IsActionRejection(err) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    } else if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not store the action")
+        return
+    }
+
+    var result GameActionResponse
+    result.Success = true
+    result.Result, err = s.lookUpResult(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's result")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+// Expects a GET request
+func (s *server) gameActionsHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(GameActionsRequest)
+    err := httpparse.HttpParamsToStruct(r, request, "url")
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if !s.checkViewer(w, request.GameID, request.PlayerID) {
+        return
+    }
+    if request.Since < 0 {
+        apierror.Write(w, apierror.BadRequest, "Action IDs are never negative")
+        return
+    }
+
+    actions, err := s.store.GetGameActions(request.GameID, uint(request.Since))
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's actions")
+        return
+    }
+
+    var result GameActionsResponse
+    result.Actions = make([]ActionEvent, 0, len(actions))
+    for _, a := range actions {
+        result.Actions = append(result.Actions, toActionEvent(a))
+    }
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+func toActionEvent(a GameAction) ActionEvent {
+    return ActionEvent{ID: a.ID, Seat: a.Seat, Action: a.Action, Turn: a.Turn}
+}
@@ -0,0 +1,152 @@
+package main
+
+// Chat between the players of a game
+//
+// Messages are plain text: they must be valid UTF-8 made of printable
+//  characters, and json.Marshal escapes <, >, and & so that a message cannot
+//  be mistaken for markup.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/httpparse"
+    "net/http"
+    "strings"
+    "unicode/utf8"
+)
+
+const (
+    maxMessageLength = 200
+    // Each seat may send at most chatRateLimit messages per chatRateWindow
+    //  seconds
+    chatRateLimit = 5
+    chatRateWindow = 10
+    // Most messages returned by one /messages call
+    maxMessagesPerRequest = 100
+)
+
+type SendMessageRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+    Text string `json:"text"`
+}
+func (smr *SendMessageRequest) Strings() []string {
+    return []string{smr.Text}
+}
+// `Since` is the ID of the last message the client has seen, or 0 for all
+type MessagesRequest struct {
+    GameID ID   `url:"gameID"`
+    PlayerID ID `url:"playerID"`
+    Since int   `url:"since"`
+}
+type ChatMessageResponse struct {
+    ID uint        `json:"id"`
+    Seat int       `json:"seat"`
+    Text string    `json:"text"`
+    Timestamp Time `json:"timestamp"`
+}
+// Fewer than maxMessagesPerRequest messages means there are no more for now
+type MessagesResponse struct {
+    Messages []ChatMessageResponse `json:"messages"`
+}
+
+// Expects a POST request
+func (s *server) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(SendMessageRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    request.Text = strings.TrimSpace(request.Text)
+    if request.Text == "" || utf8.RuneCountInString(request.Text) > maxMessageLength {
+        apierror.Writef(w, apierror.BadRequest, "Messages need 1 to %d characters", maxMessageLength)
+        return
+    }
+    if !database.StringsAreSafe(request) {
+        apierror.Write(w, apierror.BadRequest, "Messages may only contain printable characters")
+        return
+    }
+
+    playerSeat, found, err := s.store.GetPlayerSeat(request.PlayerID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player's seat")
+        return
+    }
+
+    recent, err := s.store.CountRecentChatMessages(request.GameID, playerSeat.Seat, chatRateWindow)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up recent messages")
+        return
+    }
+    if recent >= chatRateLimit {
+        apierror.Writef(w, apierror.BadRequest, "At most %d messages may be sent every %d seconds",
+                        chatRateLimit, chatRateWindow)
+        return
+    }
+
+    message := ChatMessage{GameID: request.GameID, Seat: playerSeat.Seat, Text: request.Text}
+    if err = s.store.InsertChatMessage(&message); err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not send the message")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Message sent")
+}
+
+// Expects a GET request
+func (s *server) messagesHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(MessagesRequest)
+    err := httpparse.HttpParamsToStruct(r, request, "url")
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    if request.Since < 0 {
+        apierror.Write(w, apierror.BadRequest, "Message IDs are never negative")
+        return
+    }
+    messages, err := s.store.GetChatMessages(request.GameID, uint(request.Since), maxMessagesPerRequest)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the messages")
+        return
+    }
+
+    var result MessagesResponse
+    result.Messages = make([]ChatMessageResponse, 0, len(messages))
+    for _, m := range messages {
+        result.Messages = append(result.Messages, ChatMessageResponse{ID: m.ID, Seat: m.Seat,
+                                                                      Text: m.Text,
+                                                                      Timestamp: m.Timestamp})
+    }
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
@@ -3,25 +3,76 @@ package main
 // Import the exported project types without a prefix
 import . "linegames/backend/internal/types"
 import (
+    "context"
     "encoding/json"
+    "errors"
+    "linegames/backend/internal/apierror"
     "linegames/backend/internal/database"
+    "linegames/backend/internal/gameplay"
     "linegames/backend/internal/httpparse"
+    "linegames/backend/internal/rules"
     "log"
     "net/http"
+    "time"
 )
-type Position struct {
-    X int   `json:"col"`
-    Y int   `json:"row"`
+
+const (
+    // Longest time a /request-move call may wait for the move to be made
+    maxWaitSeconds = 30
+    // Most moves returned by one /moves call
+    maxMovesPerRequest = 1000
+)
+// The read-only requests below (all but MakeMoveRequest) accept a spectator ID
+//  from the setup server's /spectate in place of a player ID
+
+// `Winner` is -1 unless the game is over and was not a draw. `Reason` is a
+//  types.EndReason.
+type GameResult struct {
+    Over bool        `json:"over"`
+    Winner int       `json:"winner"`
+    Line []Position  `json:"line"`
+    Reason EndReason `json:"reason"`
 }
+// When `Wait` is positive and the move has not been made yet, the response is
+//  held for up to `Wait` seconds (capped at maxWaitSeconds) until it is made
+//  or the game ends
 type RequestMoveRequest struct {
     GameID ID   `url:"gameID"`
     PlayerID ID `url:"playerID"`
     Turn int    `url:"turn"`
+    Wait int    `url:"wait,optional"`
 }
+// `Skipped` marks a turn which passed without a stone because its seat ran out
+//  of time, and `Pos` is left out for such turns
 type RequestMoveResponse struct {
-    Success bool    `json:"success"`
-    Pos Position    `json:"move"`
+    Success bool      `json:"success"`
+    Pos *Position     `json:"move,omitempty"`
+    Skipped bool      `json:"skipped"`
+    Result GameResult `json:"result"`
+}
+// `Limit` is optional and capped at maxMovesPerRequest
+type MovesRequest struct {
+    GameID ID     `url:"gameID"`
+    PlayerID ID   `url:"playerID"`
+    FromTurn int  `url:"fromTurn"`
+    Limit int     `url:"limit,optional"`
+}
+// `Skipped` and `Pos` are as in RequestMoveResponse
+type TurnMove struct {
+    Turn int      `json:"turn"`
+    Pos *Position `json:"move,omitempty"`
+    Skipped bool  `json:"skipped"`
+}
+// Fewer than the requested number of moves means there are no more for now
+type MovesResponse struct {
+    Moves []TurnMove `json:"moves"`
+}
+type GameStateRequest struct {
+    GameID ID   `url:"gameID"`
+    PlayerID ID `url:"playerID"`
 }
+// Resubmitting the move already made for `Turn` succeeds again, while a
+//  different move for a turn which was already played is a MoveConflict
 type MakeMoveRequest struct {
     GameID ID   `json:"gameID"`
     PlayerID ID `json:"playerID"`
@@ -30,40 +81,97 @@ type MakeMoveRequest struct {
     Turn int    `json:"turn"`
 }
 type MakeMoveResponse struct {
-    Success bool    `json:"success"`
-    Pos Position    `json:"move"`
+    Success bool      `json:"success"`
+    Pos Position      `json:"move"`
+    Result GameResult `json:"result"`
+}
+
+type server struct {
+    store database.Store
+}
+
+// Writes an error response and returns false unless `viewerID` is a player in
+//  or a spectator of the game. Only for read-only endpoints.
+func (s *server) checkViewer(w http.ResponseWriter, gameID ID, viewerID ID) bool {
+    player, found, err := s.store.GetPlayer(viewerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return false
+    }
+    if found && player.GameID == gameID {
+        return true
+    }
+    spectator, found, err := s.store.GetSpectator(viewerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the spectator")
+        return false
+    }
+    if !found || spectator.GameID != gameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return false
+    }
+    return true
+}
+
+// Records any timeouts in the game, so that reads reflect them
+func (s *server) enforceClock(gameID ID) error {
+    game, found, err := s.store.GetGame(gameID)
+    if !found || err != nil {
+        return err
+    }
+    return gameplay.EnforceClock(s.store, game)
+}
+
+func (s *server) lookUpResult(gameID ID) (GameResult, error) {
+    var gr GameResult
+    result, found, err := s.store.GetResult(gameID)
+    if err != nil {
+        return gr, err
+    }
+    gr.Over = found
+    gr.Winner = -1
+    gr.Line = []Position{}
+    if found {
+        gr.Winner = result.Winner
+        gr.Line = result.Line
+        gr.Reason = result.Reason
+    }
+    return gr, nil
 }
 
 // Expects a POST request
-func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) makeMoveHandler(w http.ResponseWriter, r *http.Request) {
 
     request := new(MakeMoveRequest)
     err := json.NewDecoder(r.Body).Decode(request)
     if (err != nil) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
-    player, found, err := database.GetPlayer(request.PlayerID)
-    if !found || player.GameID != request.GameID {
-        w.WriteHeader(http.StatusBadRequest)
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
         return
     }
-    if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
         return
     }
 
-    playerSeat, found, err := database.GetPlayerSeat(request.PlayerID)
+    playerSeat, found, err := s.store.GetPlayerSeat(request.PlayerID)
     if !found || err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player's seat")
+        return
+    }
+    if playerSeat.Type == AI {
+        // The AI server plays these turns at the seat's own difficulty
+        apierror.Write(w, apierror.BadRequest, "AI seats are played by the server")
         return
     }
-    game, found, err := database.GetGame(request.GameID)
+    game, found, err := s.store.GetGame(request.GameID)
     if !found || err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
         return
     }
 
@@ -71,7 +179,7 @@ func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
         // This player should not be moving on this turn
         //
         // This is either a glitch or an attempt to cheat
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Writef(w, apierror.BadRequest, "Turn %d belongs to another seat", request.Turn)
         return
     }
 
@@ -81,66 +189,239 @@ func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
     move.GameID = request.GameID
     move.Turn = request.Turn
 
-    _, alreadyPresent, _ := database.GetMove(request.GameID, request.Turn)
-    if !alreadyPresent {
-        err = database.InsertMove(&move)
-        if err != nil {
-            w.WriteHeader(http.StatusServiceUnavailable)
+    inserted, err := gameplay.SubmitMove(s.store, game, &move)
+    if errors.Is(err, rules.ErrGameOver) {
+        apierror.Write(w, apierror.GameOver, err.Error())
+        return
+    } else if gameplay.IsRejection(err) {
+        // Either a glitch or an attempt to cheat
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    } else if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not store the move")
+        return
+    }
+    if !inserted {
+        // Clients resubmit moves they are unsure reached the server, so only a
+        //  different move conflicts with the one stored for the turn
+        stored, found, err := s.store.GetMove(request.GameID, request.Turn)
+        if !found || err != nil {
+            apierror.Write(w, apierror.Overloaded, "Could not look up the move")
+            return
+        }
+        if rules.IsPass(stored) || stored.X != move.X || stored.Y != move.Y {
+            apierror.Writef(w, apierror.MoveConflict, "Turn %d was already played", request.Turn)
             return
         }
-    } else {
-        log.Printf("Attempted to submit move %d more than once in game %d", request.Turn, request.GameID)
     }
-
     var result MakeMoveResponse
     result.Pos.X = move.X
     result.Pos.Y = move.Y
     result.Success = true
+    result.Result, err = s.lookUpResult(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's result")
+        return
+    }
     w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
     marshalled, _ := json.Marshal(result)
     w.Write(marshalled)
 }
 
 // Expects a GET request
-func requestMoveHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) requestMoveHandler(w http.ResponseWriter, r *http.Request) {
 
     request := new(RequestMoveRequest)
     err := httpparse.HttpParamsToStruct(r, request, "url")
     if (err != nil) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
-    player, found, err := database.GetPlayer(request.PlayerID)
-    if !found || player.GameID != request.GameID {
-        w.WriteHeader(http.StatusBadRequest)
+    if !s.checkViewer(w, request.GameID, request.PlayerID) {
         return
     }
+
+    move, found, err := s.waitForMove(r.Context(), request.GameID, request.Turn, request.Wait)
+
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the move")
         return
     }
 
-    move, found, err := database.GetMove(request.GameID, request.Turn)
+    var result RequestMoveResponse
+    turnMove := toTurnMove(move)
+    result.Pos = turnMove.Pos
+    result.Skipped = turnMove.Skipped
+    result.Success = found
+    result.Result, err = s.lookUpResult(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's result")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+// Expects a GET request
+func (s *server) movesHandler(w http.ResponseWriter, r *http.Request) {
 
+    request := new(MovesRequest)
+    err := httpparse.HttpParamsToStruct(r, request, "url")
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if !s.checkViewer(w, request.GameID, request.PlayerID) {
+        return
+    }
+
+    if err = s.enforceClock(request.GameID); err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not check the game's clock")
+        return
+    }
+
+    if request.Limit <= 0 || request.Limit > maxMovesPerRequest {
+        request.Limit = maxMovesPerRequest
+    }
+    moves, err := s.store.GetMoves(request.GameID, request.FromTurn, request.Limit)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the moves")
         return
     }
 
-    var result RequestMoveResponse
-    result.Pos.X = move.X
-    result.Pos.Y = move.Y
-    result.Success = found
+    var result MovesResponse
+    result.Moves = make([]TurnMove, 0, len(moves))
+    for _, m := range moves {
+        result.Moves = append(result.Moves, toTurnMove(m))
+    }
     w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
     marshalled, _ := json.Marshal(result)
     w.Write(marshalled)
 }
 
+// Expects a GET request
+func (s *server) gameStateHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(GameStateRequest)
+    err := httpparse.HttpParamsToStruct(r, request, "url")
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if !s.checkViewer(w, request.GameID, request.PlayerID) {
+        return
+    }
+    game, found, err := s.store.GetGame(request.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    spec, found, err := s.store.GetSpec(request.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's spec")
+        return
+    }
+
+    if err = gameplay.EnforceClock(s.store, game); err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not check the game's clock")
+        return
+    }
+
+    moves, err := s.store.GetAllMoves(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the moves")
+        return
+    }
+    board, err := rules.Replay(spec.Spec, game.NumPlayers, moves)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not rebuild the board")
+        return
+    }
+
+    state := board.State()
+    if game.Begun && gameplay.HasClock(spec.Spec.Clock) {
+        clock := gameplay.ComputeClock(spec.Spec.Clock, game, moves)
+        state.Deadline = clock.Deadline
+        state.Banks = clock.Banks
+    }
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(state)
+    w.Write(marshalled)
+}
+
+// Skipped turns are reported as such rather than by rules.Pass's coordinates,
+//  which clients would otherwise try to place a stone at
+func toTurnMove(m Move) TurnMove {
+    if rules.IsPass(m) {
+        return TurnMove{Turn: m.Turn, Skipped: true}
+    }
+    return TurnMove{Turn: m.Turn, Pos: &Position{X: m.X, Y: m.Y}}
+}
+
+// Looks up the move for `turn`, waiting up to `waitSeconds` for it to be made
+//  if it is not there yet. Stops waiting early if the game ends or the client
+//  goes away.
+func (s *server) waitForMove(ctx context.Context, gameID ID, turn int, waitSeconds int) (Move, bool, error) {
+    if waitSeconds <= 0 {
+        if err := s.enforceClock(gameID); err != nil {
+            return Move{}, false, err
+        }
+        return s.store.GetMove(gameID, turn)
+    }
+    waitSeconds = min(waitSeconds, maxWaitSeconds)
+
+    // Subscribe before the first read so that no change can slip in between
+    wake, cancel := s.store.Subscribe(gameID)
+    defer cancel()
+    timeout := time.NewTimer(time.Duration(waitSeconds) * time.Second)
+    defer timeout.Stop()
+    // Clocks expire without any notification, so they are checked regularly
+    refresh := time.NewTicker(streamRefresh)
+    defer refresh.Stop()
+    for {
+        if err := s.enforceClock(gameID); err != nil {
+            return Move{}, false, err
+        }
+        move, found, err := s.store.GetMove(gameID, turn)
+        if found || err != nil {
+            return move, found, err
+        }
+        _, over, err := s.store.GetResult(gameID)
+        if over || err != nil {
+            return move, false, err
+        }
+
+        select {
+        case <-wake:
+        case <-refresh.C:
+        case <-timeout.C:
+            return move, false, nil
+        case <-ctx.Done():
+            return move, false, nil
+        }
+    }
+}
+
+func (s *server) routes() *http.ServeMux {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/make-move",    s.makeMoveHandler)
+    mux.HandleFunc("/request-move", s.requestMoveHandler)
+    mux.HandleFunc("/game-events",  s.gameEventsHandler)
+    mux.HandleFunc("/game-state",   s.gameStateHandler)
+    mux.HandleFunc("/moves",        s.movesHandler)
+    mux.HandleFunc("/game-action",  s.gameActionHandler)
+    mux.HandleFunc("/game-actions", s.gameActionsHandler)
+    mux.HandleFunc("/send-message", s.sendMessageHandler)
+    mux.HandleFunc("/messages",     s.messagesHandler)
+    return mux
+}
+
 func main() {
-    http.HandleFunc("/make-move",    makeMoveHandler)
-    http.HandleFunc("/request-move", requestMoveHandler)
-    log.Fatal(http.ListenAndServe(":3333", nil))
+    s := &server{store: database.NewPostgresStore()}
+    log.Fatal(http.ListenAndServe(":3333", s.routes()))
 }
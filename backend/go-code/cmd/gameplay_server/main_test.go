@@ -0,0 +1,756 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    . "linegames/backend/internal/types"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/memstore"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+const (
+    testGameID = 100
+    firstPlayerID = 200  // Seat i is held by player firstPlayerID + i
+    secondPlayerID = 201
+    spectatorID = 300
+)
+
+// The game served by serveTestGame. The zero value is a begun tic-tac-toe
+//  game between two human players, without a clock.
+type testGame struct {
+    seats []SeatType  // The type of each seat, all claimed; two human seats if nil
+    notBegun bool
+    clock TimeControl
+    begunAgo int      // Seconds since the game began
+}
+
+// Seat i is held by player firstPlayerID + i, and spectatorID watches
+func serveTestGame(t *testing.T, tg testGame) *httptest.Server {
+    s := &server{store: newTestStore(t, tg)}
+    return httptest.NewServer(s.routes())
+}
+
+// The store behind serveTestGame, for tests which look past the API. Seat 0's
+//  player is the host.
+func newTestStore(t *testing.T, tg testGame) *memstore.MemoryStore {
+    if tg.seats == nil {
+        tg.seats = []SeatType{Human, Human}
+    }
+    game := Game{ID: testGameID, Name: "test", Password: "secret", NumPlayers: len(tg.seats),
+                 Begun: !tg.notBegun, HostID: firstPlayerID}
+    if game.Begun {
+        game.BegunAt = Time(time.Now().Unix()) - Time(tg.begunAgo)
+    }
+    spec := Spec{GameID: testGameID}
+    spec.Spec.Board = GameBoard{Width: 3, Height: 3}
+    spec.Spec.Rules = GameRules{WinningLength: 3}
+    spec.Spec.Clock = tg.clock
+
+    players := make([]Player, len(tg.seats))
+    seats := make([]Seat, len(tg.seats))
+    for i, seatType := range tg.seats {
+        players[i] = Player{ID: firstPlayerID + ID(i), GameID: testGameID}
+        seats[i] = Seat{GameID: testGameID, PlayerID: firstPlayerID + ID(i), Seat: i, Type: seatType,
+                        Claimed: true}
+    }
+    store := memstore.New()
+    if err := store.CreateGame(&game, &spec, players, seats); err != nil {
+        t.Fatalf("Could not create test game: %v", err)
+    }
+    if err := store.InsertSpectator(&Spectator{ID: spectatorID, GameID: testGameID}); err != nil {
+        t.Fatalf("Could not add test spectator: %v", err)
+    }
+    return store
+}
+
+// Plays `turn` as the seat whose turn it is in a two-player game
+func makeMove(t *testing.T, ts *httptest.Server, turn int, x int, y int) (int, MakeMoveResponse) {
+    return makeMoveAs(t, ts, firstPlayerID + ID(turn % 2), turn, x, y)
+}
+
+func makeMoveAs(t *testing.T, ts *httptest.Server, playerID ID, turn int, x int,
+                y int) (int, MakeMoveResponse) {
+    var response MakeMoveResponse
+    request := MakeMoveRequest{GameID: testGameID, PlayerID: playerID, X: x, Y: y, Turn: turn}
+    marshalled, _ := json.Marshal(request)
+    resp, err := http.Post(ts.URL + "/make-move", "application/json", bytes.NewReader(marshalled))
+    if err != nil {
+        t.Fatalf("POST /make-move failed: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK {
+        json.NewDecoder(resp.Body).Decode(&response)
+    }
+    return resp.StatusCode, response
+}
+
+func requestMove(t *testing.T, ts *httptest.Server, turn int) RequestMoveResponse {
+    url := fmt.Sprintf("%s/request-move?gameID=%d&playerID=%d&turn=%d",
+                       ts.URL, testGameID, firstPlayerID, turn)
+    return getRequestMove(t, url)
+}
+
+func getRequestMove(t *testing.T, url string) RequestMoveResponse {
+    var response RequestMoveResponse
+    resp, err := http.Get(url)
+    if err != nil {
+        t.Fatalf("GET /request-move failed: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("Expected 200 from /request-move, got %d", resp.StatusCode)
+    }
+    json.NewDecoder(resp.Body).Decode(&response)
+    return response
+}
+
+func TestMakeAndRequestMove(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    if response := requestMove(t, ts, 0); response.Success {
+        t.Errorf("Move reported before it was made")
+    }
+    code, made := makeMove(t, ts, 0, 1, 1)
+    if code != http.StatusOK || !made.Success || made.Result.Over {
+        t.Fatalf("Move not accepted: %d %+v", code, made)
+    }
+    response := requestMove(t, ts, 0)
+    if !response.Success || *response.Pos != (Position{X: 1, Y: 1}) {
+        t.Errorf("Wrong move reported: %+v", response)
+    }
+}
+
+func TestRequestMoveWaits(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    url := fmt.Sprintf("%s/request-move?gameID=%d&playerID=%d&turn=0&wait=1",
+                       ts.URL, testGameID, secondPlayerID)
+    start := time.Now()
+    if response := getRequestMove(t, url); response.Success {
+        t.Errorf("Move reported before it was made")
+    }
+    if elapsed := time.Since(start); elapsed < time.Second {
+        t.Errorf("Returned after %v instead of waiting", elapsed)
+    }
+
+    responses := make(chan RequestMoveResponse)
+    url = fmt.Sprintf("%s/request-move?gameID=%d&playerID=%d&turn=0&wait=10",
+                      ts.URL, testGameID, secondPlayerID)
+    go func() { responses <- getRequestMove(t, url) }()
+    time.Sleep(100 * time.Millisecond)
+    start = time.Now()
+    makeMove(t, ts, 0, 2, 2)
+    response := <-responses
+    if !response.Success || *response.Pos != (Position{X: 2, Y: 2}) {
+        t.Errorf("Wrong move reported: %+v", response)
+    }
+    if elapsed := time.Since(start); elapsed > 2 * time.Second {
+        t.Errorf("Took %v to report the move", elapsed)
+    }
+}
+
+func TestGameState(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    makeMove(t, ts, 1, 2, 0)
+    makeMove(t, ts, 2, 0, 2)
+
+    url := fmt.Sprintf("%s/game-state?gameID=%d&playerID=%d", ts.URL, testGameID, secondPlayerID)
+    resp, err := http.Get(url)
+    if err != nil {
+        t.Fatalf("GET /game-state failed: %v", err)
+    }
+    defer resp.Body.Close()
+    var state GameState
+    if err = json.NewDecoder(resp.Body).Decode(&state); err != nil {
+        t.Fatalf("Bad response from /game-state: %v", err)
+    }
+    expected := [][]int{[]int{-1, -1, 1}, []int{-1, 0, -1}, []int{0, -1, -1}}
+    if fmt.Sprint(state.Board) != fmt.Sprint(expected) {
+        t.Errorf("Expected board %v, got %v", expected, state.Board)
+    }
+    if state.Turn != 3 || state.Player != 1 || fmt.Sprint(state.Captures) != "[0 0]" {
+        t.Errorf("Wrong turn, player, or captures: %+v", state)
+    }
+}
+
+func TestMoves(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    makeMove(t, ts, 1, 2, 0)
+    makeMove(t, ts, 2, 0, 2)
+
+    getMoves := func(query string) MovesResponse {
+        var response MovesResponse
+        url := fmt.Sprintf("%s/moves?gameID=%d&playerID=%d&%s", ts.URL, testGameID, firstPlayerID, query)
+        resp, err := http.Get(url)
+        if err != nil {
+            t.Fatalf("GET /moves failed: %v", err)
+        }
+        defer resp.Body.Close()
+        json.NewDecoder(resp.Body).Decode(&response)
+        return response
+    }
+
+    all := getMoves("fromTurn=0")
+    if len(all.Moves) != 3 || all.Moves[2].Turn != 2 || *all.Moves[2].Pos != (Position{X: 0, Y: 2}) {
+        t.Errorf("Expected all 3 moves, got %+v", all.Moves)
+    }
+    page := getMoves("fromTurn=1&limit=1")
+    if len(page.Moves) != 1 || page.Moves[0].Turn != 1 || *page.Moves[0].Pos != (Position{X: 2, Y: 0}) {
+        t.Errorf("Expected only turn 1, got %+v", page.Moves)
+    }
+    if none := getMoves("fromTurn=3"); none.Moves == nil || len(none.Moves) != 0 {
+        t.Errorf("Expected an empty list, got %+v", none.Moves)
+    }
+}
+
+func TestSpectatorsMayOnlyRead(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    url := fmt.Sprintf("%s/request-move?gameID=%d&playerID=%d&turn=0", ts.URL, testGameID, spectatorID)
+    if response := getRequestMove(t, url); !response.Success || *response.Pos != (Position{X: 1, Y: 1}) {
+        t.Errorf("Spectator saw the wrong move: %+v", response)
+    }
+
+    resp, err := http.Get(fmt.Sprintf("%s/game-state?gameID=%d&playerID=%d", ts.URL, testGameID, spectatorID))
+    if err != nil {
+        t.Fatalf("GET /game-state failed: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Errorf("Expected 200 from /game-state for a spectator, got %d", resp.StatusCode)
+    }
+
+    request := MakeMoveRequest{GameID: testGameID, PlayerID: spectatorID, X: 0, Y: 0, Turn: 1}
+    marshalled, _ := json.Marshal(request)
+    resp, err = http.Post(ts.URL + "/make-move", "application/json", bytes.NewReader(marshalled))
+    if err != nil {
+        t.Fatalf("POST /make-move failed: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a spectator's move, got %d", resp.StatusCode)
+    }
+}
+
+func TestAISeatsCannotMove(t *testing.T) {
+    ts := serveTestGame(t, testGame{seats: []SeatType{AI, Human}})
+    defer ts.Close()
+
+    // The AI server plays seat 0's turns
+    if code, _ := makeMove(t, ts, 0, 1, 1); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a move with an AI seat's player ID, got %d", code)
+    }
+}
+
+func TestDuplicateMoves(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    if code, made := makeMove(t, ts, 0, 1, 1); code != http.StatusOK || !made.Success {
+        t.Errorf("Expected a repeated move to succeed again, got %d %+v", code, made)
+    }
+
+    marshalled, _ := json.Marshal(MakeMoveRequest{GameID: testGameID, PlayerID: firstPlayerID, X: 2, Y: 2})
+    resp, err := http.Post(ts.URL + "/make-move", "application/json", bytes.NewReader(marshalled))
+    if err != nil {
+        t.Fatalf("POST /make-move failed: %v", err)
+    }
+    defer resp.Body.Close()
+    var status apierror.RequestStatus
+    json.NewDecoder(resp.Body).Decode(&status)
+    if resp.StatusCode != http.StatusConflict || status.Status != apierror.MoveConflict {
+        t.Errorf("Expected a move conflict for a different move, got %d %+v", resp.StatusCode, status)
+    }
+    if response := requestMove(t, ts, 0); *response.Pos != (Position{X: 1, Y: 1}) {
+        t.Errorf("Expected the first move to be the one stored, got %+v", *response.Pos)
+    }
+}
+
+func TestRejectedMoves(t *testing.T) {
+    // Each move follows a first move in the center, unless the game has not
+    //  begun
+    tests := []struct {
+        name string
+        game testGame
+        turn, x, y int
+        message string  // Expected within the error message
+    }{
+        {"occupied cell", testGame{}, 1, 1, 1, "already occupied"},
+        {"out of bounds", testGame{}, 1, 3, 0, "outside the board"},
+        {"ahead of the next turn", testGame{}, 3, 0, 0, "next turn is 1"},
+        {"game not begun", testGame{notBegun: true}, 0, 0, 0, "not begun"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            ts := serveTestGame(t, test.game)
+            defer ts.Close()
+
+            makeMove(t, ts, 0, 1, 1)
+            request := MakeMoveRequest{GameID: testGameID, PlayerID: firstPlayerID + ID(test.turn % 2),
+                                       X: test.x, Y: test.y, Turn: test.turn}
+            marshalled, _ := json.Marshal(request)
+            resp, err := http.Post(ts.URL + "/make-move", "application/json", bytes.NewReader(marshalled))
+            if err != nil {
+                t.Fatalf("POST /make-move failed: %v", err)
+            }
+            defer resp.Body.Close()
+            var status apierror.RequestStatus
+            json.NewDecoder(resp.Body).Decode(&status)
+            if resp.StatusCode != http.StatusBadRequest || status.Success || status.Status != apierror.BadRequest ||
+               !strings.Contains(status.Message, test.message) {
+                t.Errorf("Expected a bad request status mentioning %q, got %d %+v",
+                         test.message, resp.StatusCode, status)
+            }
+        })
+    }
+}
+
+func TestResultReported(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    moves := []Position{Position{X: 0, Y: 0}, Position{X: 0, Y: 1},
+                        Position{X: 1, Y: 0}, Position{X: 1, Y: 1},
+                        Position{X: 2, Y: 0}}
+    var made MakeMoveResponse
+    for turn, p := range moves {
+        var code int
+        code, made = makeMove(t, ts, turn, p.X, p.Y)
+        if code != http.StatusOK {
+            t.Fatalf("Move %d not accepted: %d", turn, code)
+        }
+    }
+    if !made.Result.Over || made.Result.Winner != 0 || len(made.Result.Line) != 3 {
+        t.Errorf("Expected seat 0 to win, got %+v", made.Result)
+    }
+    if code, again := makeMove(t, ts, 4, 2, 0); code != http.StatusOK || !again.Result.Over {
+        t.Errorf("Expected the final move to be accepted again, got %d %+v", code, again)
+    }
+    if response := requestMove(t, ts, 4); !response.Result.Over || response.Result.Winner != 0 {
+        t.Errorf("Result not reported to the other player: %+v", response.Result)
+    }
+}
+
+// Reads the next event from a /game-events stream, skipping comments
+func nextEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+    var name, data string
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            t.Fatalf("Stream ended early: %v", err)
+        }
+        line = strings.TrimSuffix(line, "\n")
+        if line == "" && name != "" {
+            return name, data
+        }
+        if strings.HasPrefix(line, "event: ") {
+            name = strings.TrimPrefix(line, "event: ")
+        } else if strings.HasPrefix(line, "data: ") {
+            data = strings.TrimPrefix(line, "data: ")
+        }
+    }
+}
+
+func TestGameEvents(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+
+    // Well below streamRefresh, so the move must be pushed rather than polled
+    ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+    defer cancel()
+    url := fmt.Sprintf("%s/game-events?gameID=%d&playerID=%d&turn=0",
+                       ts.URL, testGameID, firstPlayerID)
+    request, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    resp, err := http.DefaultClient.Do(request)
+    if err != nil {
+        t.Fatalf("GET /game-events failed: %v", err)
+    }
+    defer resp.Body.Close()
+    reader := bufio.NewReader(resp.Body)
+
+    for i := 0; i < 2; i++ {
+        if name, data := nextEvent(t, reader); name != "seat" || !strings.Contains(data, `"claimed":true`) {
+            t.Errorf("Expected a claimed seat, got %s %s", name, data)
+        }
+    }
+    if name, data := nextEvent(t, reader); name != "move" || data != `{"turn":0,"move":{"col":1,"row":1},"skipped":false}` {
+        t.Errorf("Expected the existing move, got %s %s", name, data)
+    }
+
+    makeMove(t, ts, 1, 0, 0)
+    if name, data := nextEvent(t, reader); name != "move" || data != `{"turn":1,"move":{"col":0,"row":0},"skipped":false}` {
+        t.Errorf("Expected the new move to be pushed, got %s %s", name, data)
+    }
+}
+
+func TestChat(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    send := func(playerID ID, text string) int {
+        marshalled, _ := json.Marshal(SendMessageRequest{GameID: testGameID, PlayerID: playerID, Text: text})
+        resp, err := http.Post(ts.URL + "/send-message", "application/json", bytes.NewReader(marshalled))
+        if err != nil {
+            t.Fatalf("POST /send-message failed: %v", err)
+        }
+        resp.Body.Close()
+        return resp.StatusCode
+    }
+    getMessages := func(since int) MessagesResponse {
+        var response MessagesResponse
+        url := fmt.Sprintf("%s/messages?gameID=%d&playerID=%d&since=%d", ts.URL, testGameID, secondPlayerID, since)
+        resp, err := http.Get(url)
+        if err != nil {
+            t.Fatalf("GET /messages failed: %v", err)
+        }
+        defer resp.Body.Close()
+        json.NewDecoder(resp.Body).Decode(&response)
+        return response
+    }
+
+    if code := send(firstPlayerID, "good luck"); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if code := send(secondPlayerID, "<b>you too</b>"); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    all := getMessages(0)
+    if len(all.Messages) != 2 || all.Messages[0].Text != "good luck" || all.Messages[0].Seat != 0 ||
+            all.Messages[1].Seat != 1 {
+        t.Fatalf("Expected both messages in order, got %+v", all.Messages)
+    }
+    if newer := getMessages(int(all.Messages[0].ID)); len(newer.Messages) != 1 {
+        t.Errorf("Expected only the second message, got %+v", newer.Messages)
+    }
+
+    if code := send(spectatorID, "hello"); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a spectator's message, got %d", code)
+    }
+    if code := send(firstPlayerID, "   "); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an empty message, got %d", code)
+    }
+    if code := send(firstPlayerID, "bell\a"); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a control character, got %d", code)
+    }
+    if code := send(firstPlayerID, strings.Repeat("a", maxMessageLength + 1)); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a long message, got %d", code)
+    }
+
+    for i := 1; i < chatRateLimit; i++ {
+        send(firstPlayerID, "spam")
+    }
+    if code := send(firstPlayerID, "spam"); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 once the rate limit was reached, got %d", code)
+    }
+}
+
+func takeAction(t *testing.T, ts *httptest.Server, playerID ID, action ActionType) (int, GameActionResponse) {
+    var response GameActionResponse
+    marshalled, _ := json.Marshal(GameActionRequest{GameID: testGameID, PlayerID: playerID, Action: action})
+    resp, err := http.Post(ts.URL + "/game-action", "application/json", bytes.NewReader(marshalled))
+    if err != nil {
+        t.Fatalf("POST /game-action failed: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK {
+        json.NewDecoder(resp.Body).Decode(&response)
+    }
+    return resp.StatusCode, response
+}
+
+func TestResign(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    code, response := takeAction(t, ts, firstPlayerID, Resign)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Winner != 1 ||
+            response.Result.Reason != Resigned {
+        t.Fatalf("Expected seat 1 to win by resignation, got %d %+v", code, response)
+    }
+    if code, _ := makeMove(t, ts, 1, 0, 0); code != http.StatusConflict {
+        t.Errorf("Expected 409 for a move after resigning, got %d", code)
+    }
+    if code, _ := takeAction(t, ts, secondPlayerID, Resign); code != http.StatusConflict {
+        t.Errorf("Expected 409 for resigning a finished game, got %d", code)
+    }
+}
+
+func TestResignInMultiplayer(t *testing.T) {
+    ts := serveTestGame(t, testGame{seats: []SeatType{Human, Human, Human}})
+    defer ts.Close()
+
+    makeMoveAs(t, ts, firstPlayerID, 0, 0, 0)
+    // Seat 1 resigns on its own turn, which passes to seat 2
+    code, response := takeAction(t, ts, firstPlayerID + 1, Resign)
+    if code != http.StatusOK || response.Result.Over {
+        t.Fatalf("Expected the game to go on after one of three seats resigned, got %d %+v", code, response)
+    }
+    if state := getGameState(t, ts); state.Turn != 2 || state.Player != 2 {
+        t.Errorf("Expected seat 2 to be up on turn 2, got turn %d for seat %d", state.Turn, state.Player)
+    }
+    if code, _ := takeAction(t, ts, firstPlayerID + 1, OfferDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an action by a resigned seat, got %d", code)
+    }
+
+    // Seat 1's later turns pass as soon as they come up
+    makeMoveAs(t, ts, firstPlayerID + 2, 2, 1, 1)
+    if code, _ := makeMoveAs(t, ts, firstPlayerID, 3, 2, 2); code != http.StatusOK {
+        t.Fatalf("Expected 200 for seat 0's move, got %d", code)
+    }
+    if state := getGameState(t, ts); state.Turn != 5 || state.Player != 2 {
+        t.Errorf("Expected seat 2 to be up on turn 5, got turn %d for seat %d", state.Turn, state.Player)
+    }
+
+    // The last seat left in play wins
+    code, response = takeAction(t, ts, firstPlayerID + 2, Resign)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Winner != 0 ||
+            response.Result.Reason != Resigned {
+        t.Errorf("Expected seat 0 to win by resignation, got %d %+v", code, response)
+    }
+}
+
+func TestAbandon(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    code, response := takeAction(t, ts, firstPlayerID, Abandon)
+    if code != http.StatusOK || response.Result.Over {
+        t.Fatalf("Expected the game to go on after abandoning, got %d %+v", code, response)
+    }
+    if code, _ := takeAction(t, ts, firstPlayerID, OfferDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for the abandoned player ID, got %d", code)
+    }
+
+    // Leaving only AIs behind is the same as resigning
+    code, response = takeAction(t, ts, secondPlayerID, Abandon)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Winner != 0 ||
+            response.Result.Reason != Resigned {
+        t.Errorf("Expected seat 0 to win by resignation, got %d %+v", code, response)
+    }
+}
+
+func TestAbandonByHost(t *testing.T) {
+    store := newTestStore(t, testGame{seats: []SeatType{Human, AI, Human}})
+    ts := httptest.NewServer((&server{store: store}).routes())
+    defer ts.Close()
+
+    if code, _ := takeAction(t, ts, firstPlayerID, Abandon); code != http.StatusOK {
+        t.Fatalf("Expected 200 for abandoning, got %d", code)
+    }
+    game, _, _ := store.GetGame(testGameID)
+    if game.HostID != firstPlayerID + 2 {
+        t.Errorf("Expected the remaining human player to become the host, got %d", game.HostID)
+    }
+}
+
+func TestDrawAgainstAI(t *testing.T) {
+    ts := serveTestGame(t, testGame{seats: []SeatType{Human, AI}})
+    defer ts.Close()
+
+    // The AI goes along with the only human player's offer
+    code, response := takeAction(t, ts, firstPlayerID, OfferDraw)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Reason != DrawAgreed {
+        t.Errorf("Expected an agreed draw, got %d %+v", code, response)
+    }
+}
+
+func TestDrawOffers(t *testing.T) {
+    ts := serveTestGame(t, testGame{})
+    defer ts.Close()
+
+    if code, _ := takeAction(t, ts, secondPlayerID, AcceptDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for accepting without an offer, got %d", code)
+    }
+
+    takeAction(t, ts, firstPlayerID, OfferDraw)
+    if code, _ := takeAction(t, ts, firstPlayerID, AcceptDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for accepting one's own offer, got %d", code)
+    }
+    takeAction(t, ts, secondPlayerID, DeclineDraw)
+    if code, _ := takeAction(t, ts, secondPlayerID, AcceptDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for accepting a declined offer, got %d", code)
+    }
+
+    // Offers lapse once a move is played
+    takeAction(t, ts, firstPlayerID, OfferDraw)
+    makeMove(t, ts, 0, 1, 1)
+    if code, _ := takeAction(t, ts, secondPlayerID, AcceptDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for accepting a lapsed offer, got %d", code)
+    }
+
+    takeAction(t, ts, secondPlayerID, OfferDraw)
+    code, response := takeAction(t, ts, firstPlayerID, AcceptDraw)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Winner != -1 ||
+            response.Result.Reason != DrawAgreed {
+        t.Fatalf("Expected an agreed draw, got %d %+v", code, response)
+    }
+
+    var actions GameActionsResponse
+    resp, err := http.Get(fmt.Sprintf("%s/game-actions?gameID=%d&playerID=%d&since=0", ts.URL, testGameID, spectatorID))
+    if err != nil {
+        t.Fatalf("GET /game-actions failed: %v", err)
+    }
+    defer resp.Body.Close()
+    json.NewDecoder(resp.Body).Decode(&actions)
+    if len(actions.Actions) != 5 || actions.Actions[4].Action != AcceptDraw || actions.Actions[4].Turn != 1 {
+        t.Errorf("Expected all 5 stored actions, got %+v", actions.Actions)
+    }
+}
+
+func TestDrawOfferJoinedByOffer(t *testing.T) {
+    ts := serveTestGame(t, testGame{seats: []SeatType{Human, Human, Human}})
+    defer ts.Close()
+
+    // The second offer keeps the first seat's agreement
+    takeAction(t, ts, firstPlayerID, OfferDraw)
+    code, response := takeAction(t, ts, firstPlayerID + 1, OfferDraw)
+    if code != http.StatusOK || response.Result.Over {
+        t.Fatalf("Expected the draw to wait for seat 2, got %d %+v", code, response)
+    }
+    code, response = takeAction(t, ts, firstPlayerID + 2, AcceptDraw)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Reason != DrawAgreed {
+        t.Errorf("Expected an agreed draw, got %d %+v", code, response)
+    }
+}
+
+func TestDrawAfterResigning(t *testing.T) {
+    ts := serveTestGame(t, testGame{seats: []SeatType{Human, Human, Human}})
+    defer ts.Close()
+
+    // Seat 2 left play, so only seat 1 needs to accept
+    takeAction(t, ts, firstPlayerID + 2, Resign)
+    takeAction(t, ts, firstPlayerID, OfferDraw)
+    code, response := takeAction(t, ts, firstPlayerID + 1, AcceptDraw)
+    if code != http.StatusOK || !response.Result.Over || response.Result.Reason != DrawAgreed {
+        t.Errorf("Expected an agreed draw, got %d %+v", code, response)
+    }
+}
+
+func getGameState(t *testing.T, ts *httptest.Server) GameState {
+    var state GameState
+    resp, err := http.Get(fmt.Sprintf("%s/game-state?gameID=%d&playerID=%d", ts.URL, testGameID, firstPlayerID))
+    if err != nil {
+        t.Fatalf("GET /game-state failed: %v", err)
+    }
+    defer resp.Body.Close()
+    json.NewDecoder(resp.Body).Decode(&state)
+    return state
+}
+
+func TestClockSkipsTurns(t *testing.T) {
+    // Seat 0's 30 seconds ran out 15 seconds ago
+    ts := serveTestGame(t, testGame{clock: TimeControl{PerMove: 30, OnTimeout: SkipTurn}, begunAgo: 45})
+    defer ts.Close()
+
+    state := getGameState(t, ts)
+    if state.Turn != 1 || state.Player != 1 {
+        t.Fatalf("Expected seat 0's turn to be skipped, got turn %d", state.Turn)
+    }
+    now := Time(time.Now().Unix())
+    if state.Deadline < now + 14 || state.Deadline > now + 15 {
+        t.Errorf("Expected seat 1's turn to end 15 seconds after the skip, got %d (now %d)", state.Deadline, now)
+    }
+
+    if response := requestMove(t, ts, 0); !response.Success || !response.Skipped || response.Pos != nil {
+        t.Errorf("Expected turn 0 to be reported as skipped, got %+v", response)
+    }
+
+    // The late move arrives after the skip was recorded
+    if code, _ := makeMove(t, ts, 0, 1, 1); code != http.StatusConflict {
+        t.Errorf("Expected 409 for the late move, got %d", code)
+    }
+    if code, _ := makeMove(t, ts, 1, 1, 1); code != http.StatusOK {
+        t.Errorf("Expected seat 1 to move in time, got %d", code)
+    }
+}
+
+func TestClockForfeits(t *testing.T) {
+    tests := []struct {
+        name string
+        clock TimeControl
+        begunAgo int
+        lateMove bool  // Otherwise nothing but a poll reaches the server after the timeout
+    }{
+        {"late move after the bank ran out", TimeControl{Bank: 20, Increment: 5}, 30, true},
+        {"poll after the move timed out", TimeControl{PerMove: 30}, 45, false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            ts := serveTestGame(t, testGame{clock: test.clock, begunAgo: test.begunAgo})
+            defer ts.Close()
+
+            if test.lateMove {
+                if code, _ := makeMove(t, ts, 0, 1, 1); code != http.StatusConflict {
+                    t.Errorf("Expected 409 for the late move, got %d", code)
+                }
+            }
+            response := requestMove(t, ts, 0)
+            if response.Success || !response.Result.Over || response.Result.Winner != 1 ||
+                    response.Result.Reason != TimedOut {
+                t.Errorf("Expected seat 1 to win on time, got %+v", response)
+            }
+        })
+    }
+}
+
+func TestClockForfeitsInMultiplayer(t *testing.T) {
+    // Seat 0's 30 seconds ran out 15 seconds ago, which only takes it out
+    ts := serveTestGame(t, testGame{seats: []SeatType{Human, Human, Human},
+                                    clock: TimeControl{PerMove: 30}, begunAgo: 45})
+    defer ts.Close()
+
+    if state := getGameState(t, ts); state.Turn != 1 || state.Player != 1 {
+        t.Fatalf("Expected seat 1 to be up after seat 0 forfeited, got turn %d", state.Turn)
+    }
+    if code, _ := takeAction(t, ts, firstPlayerID, OfferDraw); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an action by the forfeited seat, got %d", code)
+    }
+    makeMoveAs(t, ts, firstPlayerID + 1, 1, 1, 1)
+    makeMoveAs(t, ts, firstPlayerID + 2, 2, 0, 0)
+    if state := getGameState(t, ts); state.Turn != 4 || state.Player != 1 {
+        t.Errorf("Expected seat 0's next turn to pass, got turn %d", state.Turn)
+    }
+
+    // Seat 1's turn ran out too, 15 seconds ago, leaving seat 2 in play
+    ts = serveTestGame(t, testGame{seats: []SeatType{Human, Human, Human},
+                                   clock: TimeControl{PerMove: 30}, begunAgo: 75})
+    defer ts.Close()
+
+    response := requestMove(t, ts, 0)
+    if !response.Result.Over || response.Result.Winner != 2 || response.Result.Reason != TimedOut {
+        t.Errorf("Expected seat 2 to win on time, got %+v", response)
+    }
+}
+
+func TestClockBanks(t *testing.T) {
+    ts := serveTestGame(t, testGame{clock: TimeControl{Bank: 60, Increment: 5}, begunAgo: 10})
+    defer ts.Close()
+
+    makeMove(t, ts, 0, 1, 1)
+    state := getGameState(t, ts)
+    if len(state.Banks) != 2 || state.Banks[0] < 54 || state.Banks[0] > 55 || state.Banks[1] != 60 {
+        t.Errorf("Expected about 55 and 60 seconds left, got %v", state.Banks)
+    }
+}
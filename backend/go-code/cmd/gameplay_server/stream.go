@@ -0,0 +1,193 @@
+package main
+
+// Server-Sent Events stream of everything that happens in a game
+//
+// Each event is written as
+//      event: <move | seat | action | result>
+//      data: <JSON>
+//
+// The stream starts by describing every seat, every move from `turn` onwards,
+//  every resignation or draw offer, and the result if there is one, so a
+//  client which reconnects only needs to pass the first turn it has not seen
+//  yet. The stream ends after the result.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "fmt"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/httpparse"
+    "net/http"
+    "time"
+)
+
+const (
+    // The stream re-reads the game at least this often even without a
+    //  notification, which also keeps proxies from closing idle connections
+    streamRefresh = 5 * time.Second
+)
+
+type StreamRequest struct {
+    GameID ID   `url:"gameID"`
+    PlayerID ID `url:"playerID"`
+    Turn int    `url:"turn"`
+}
+type SeatEvent struct {
+    Seat int     `json:"seat"`
+    Claimed bool `json:"claimed"`
+}
+
+// What has already been sent on one stream
+type streamState struct {
+    game Game
+    nextTurn int
+    lastActionID uint
+    claimed map[int]bool
+    over bool
+}
+
+// Expects a GET request
+func (s *server) gameEventsHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(StreamRequest)
+    err := httpparse.HttpParamsToStruct(r, request, "url")
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if !s.checkViewer(w, request.GameID, request.PlayerID) {
+        return
+    }
+    game, found, err := s.store.GetGame(request.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        apierror.Write(w, apierror.Overloaded, "Streaming is not available")
+        return
+    }
+
+    // Subscribe before the first read so that no change can slip in between
+    wake, cancel := s.store.Subscribe(request.GameID)
+    defer cancel()
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no")  // Stop proxies from buffering
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    state := streamState{game: game, nextTurn: request.Turn, claimed: make(map[int]bool)}
+    refresh := time.NewTicker(streamRefresh)
+    defer refresh.Stop()
+    for {
+        sent, err := s.sendNewEvents(w, &state)
+        if err != nil {
+            return
+        }
+        if !sent {
+            // Comment line: ignored by clients, but fails if they are gone
+            if _, err = w.Write([]byte(":\n\n")); err != nil {
+                return
+            }
+        }
+        flusher.Flush()
+        if state.over {
+            return
+        }
+
+        select {
+        case <-r.Context().Done():
+            return
+        case <-wake:
+        case <-refresh.C:
+        }
+    }
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Writes an event for everything that changed since the last call.
+//
+// Returns true if any events were written.
+func (s *server) sendNewEvents(w http.ResponseWriter, state *streamState) (bool, error) {
+    sent := false
+
+    if err := s.enforceClock(state.game.ID); err != nil {
+        return sent, err
+    }
+
+    empty, err := s.store.GetEmptySeats(state.game.ID)
+    if err != nil {
+        return sent, err
+    }
+    isEmpty := make(map[int]bool)
+    for _, seat := range empty {
+        isEmpty[seat.Seat] = true
+    }
+    for i := 0; i < state.game.NumPlayers; i++ {
+        claimed, known := state.claimed[i]
+        if known && claimed == !isEmpty[i] {
+            continue
+        }
+        state.claimed[i] = !isEmpty[i]
+        if err = writeEvent(w, "seat", SeatEvent{Seat: i, Claimed: !isEmpty[i]}); err != nil {
+            return sent, err
+        }
+        sent = true
+    }
+
+    moves, err := s.store.GetMoves(state.game.ID, state.nextTurn, 0)
+    if err != nil {
+        return sent, err
+    }
+    for _, m := range moves {
+        if m.Turn != state.nextTurn {
+            // Wait for the missing turn so that moves are sent in order
+            break
+        }
+        if err = writeEvent(w, "move", toTurnMove(m)); err != nil {
+            return sent, err
+        }
+        state.nextTurn++
+        sent = true
+    }
+
+    actions, err := s.store.GetGameActions(state.game.ID, state.lastActionID)
+    if err != nil {
+        return sent, err
+    }
+    for _, a := range actions {
+        if err = writeEvent(w, "action", toActionEvent(a)); err != nil {
+            return sent, err
+        }
+        state.lastActionID = a.ID
+        sent = true
+    }
+
+    // Read the result after the moves and actions so that whatever ended the
+    //  game is always sent before the result
+    result, err := s.lookUpResult(state.game.ID)
+    if err != nil {
+        return sent, err
+    }
+    if result.Over {
+        if err = writeEvent(w, "result", result); err != nil {
+            return sent, err
+        }
+        state.over = true
+        sent = true
+    }
+    return sent, nil
+}
+
+func writeEvent(w http.ResponseWriter, name string, data any) error {
+    marshalled, _ := json.Marshal(data)
+    _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, marshalled)
+    return err
+}
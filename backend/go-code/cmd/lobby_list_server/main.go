@@ -5,6 +5,7 @@ import . "linegames/backend/internal/types"
 
 import (
     "encoding/json"
+    "linegames/backend/internal/apierror"
     "linegames/backend/internal/database"
     "log"
     "math/rand"
@@ -25,27 +26,34 @@ type GamesList struct {
     Ids   []ID     `json:"gameIDs"`
 }
 
+type server struct {
+    store database.Store
+}
+
 func init() {
     nextRefresh = 0
 }
 
 // Expects a GET request
-func gamesListHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) gamesListHandler(w http.ResponseWriter, r *http.Request) {
     var now Time = Time(time.Now().Unix())
     if now > nextRefresh {
         // Time to update
-        lobbyGames, err := database.GetNonBegunGames()
+        lobbyGames, err := s.store.GetNonBegunGames()
         if err != nil {
-            w.WriteHeader(http.StatusInternalServerError)
+            apierror.Write(w, apierror.Overloaded, "Could not look up the lobby games")
             return
         }
 
         var gl GamesList
-        gl.Names = make([]string, len(lobbyGames))
-        gl.Ids =   make([]ID, len(lobbyGames))
+        gl.Names = make([]string, 0, len(lobbyGames))
+        gl.Ids =   make([]ID, 0, len(lobbyGames))
         for i := 0; i < len(lobbyGames); i++ {
-            gl.Names[i] = lobbyGames[i].Name
-            gl.Ids[i] = lobbyGames[i].ID
+            if lobbyGames[i].Locked {
+                continue  // Nobody else may join
+            }
+            gl.Names = append(gl.Names, lobbyGames[i].Name)
+            gl.Ids = append(gl.Ids, lobbyGames[i].ID)
         }
         preMarshalled, _ = json.Marshal(gl)
 
@@ -68,6 +76,7 @@ func main() {
     //  database at the same time.
     time.Sleep((time.Second * avgRefreshRate * time.Duration(rand.Int31n(1001))) / 1000)
 
-    http.HandleFunc("/games-list", gamesListHandler)
+    s := &server{store: database.NewPostgresStore()}
+    http.HandleFunc("/games-list", s.gamesListHandler)
     log.Fatal(http.ListenAndServe(":1111", nil))
 }
@@ -0,0 +1,86 @@
+package main
+
+// Applies, reverts, and reports on database schema migrations
+//
+// Usage:
+//      migrate up          Apply every pending migration
+//      migrate down [n]    Revert the n (default 1) most recent migrations
+//      migrate status      List the migrations and whether they are applied
+
+import (
+    "fmt"
+    "linegames/backend/internal/dbconn"
+    "linegames/backend/internal/dbschema"
+    "log"
+    "os"
+    "strconv"
+    "time"
+)
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: %s up | down [n] | status\n", os.Args[0])
+    os.Exit(2)
+}
+
+func main() {
+    if len(os.Args) < 2 {
+        usage()
+    }
+    dbconn.Connect()
+
+    switch os.Args[1] {
+    case "up":
+        if len(os.Args) != 2 {
+            usage()
+        }
+        done, err := dbschema.Up()
+        for _, m := range done {
+            fmt.Printf("Applied  %04d_%s\n", m.Version, m.Name)
+        }
+        if err != nil {
+            log.Fatal(err)
+        }
+        if len(done) == 0 {
+            fmt.Printf("Already up to date\n")
+        }
+
+    case "down":
+        steps := 1
+        if len(os.Args) == 3 {
+            var err error
+            steps, err = strconv.Atoi(os.Args[2])
+            if err != nil || steps < 1 {
+                usage()
+            }
+        } else if len(os.Args) != 2 {
+            usage()
+        }
+        done, err := dbschema.Down(steps)
+        for _, m := range done {
+            fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+        }
+        if err != nil {
+            log.Fatal(err)
+        }
+
+    case "status":
+        if len(os.Args) != 2 {
+            usage()
+        }
+        statuses, err := dbschema.Status()
+        if err != nil {
+            log.Fatal(err)
+        }
+        for _, s := range statuses {
+            if s.Applied {
+                appliedAt := time.Unix(int64(s.AppliedAt), 0).UTC().Format(time.RFC3339)
+                fmt.Printf("%04d_%-30s applied %s\n", s.Version, s.Name, appliedAt)
+            } else {
+                fmt.Printf("%04d_%-30s pending\n", s.Version, s.Name)
+            }
+        }
+
+    default:
+        usage()
+    }
+}
@@ -15,28 +15,47 @@ const (
     lobbyTimeout = 60 * 30 
     // Games being played timeout after 24 hours (measured in seconds)
     playTimeout = 60 * 60 * 24
+    // Finished games timeout 1 hour after their result is recorded
+    finishedTimeout = 60 * 60
 
     avgPause = 60  // One minute
 )
 
 func main() {
+    store := database.NewPostgresStore()
     var timeouts []Duration = []Duration{lobbyTimeout, playTimeout}
     var begun []bool =        []bool    {false,        true       }
     var title []string =      []string  {"pending",    "active"   }
     for {
         time.Sleep(time.Second * (avgPause + (-1) + time.Duration(rand.Int31n(3))))
         for i := 0; i < 2; i++ {
-            games, err := database.GetOldGames(timeouts[i], begun[i])
+            games, err := store.GetOldGames(timeouts[i], begun[i])
             if err != nil {
                 log.Printf("Error getting old %s games: %s", title[i], err.Error())
             } else {
                 for j := 0; j < len(games); j++ {
-                    err = database.DeleteAllGameData(games[i].ID)
+                    err = store.DeleteAllGameData(games[j].ID)
                     if err != nil {
                         log.Printf("Error deleting old %s game: %s", title[i], err.Error())
                     }
                 }
             }
         }
+
+        if err := store.DeleteExpiredSessions(); err != nil {
+            log.Printf("Error deleting expired sessions: %s", err.Error())
+        }
+
+        games, err := store.GetOldFinishedGames(finishedTimeout)
+        if err != nil {
+            log.Printf("Error getting old finished games: %s", err.Error())
+            continue
+        }
+        for j := 0; j < len(games); j++ {
+            err = store.DeleteAllGameData(games[j].ID)
+            if err != nil {
+                log.Printf("Error deleting old finished game: %s", err.Error())
+            }
+        }
     }
 }
@@ -0,0 +1,249 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/auth"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/random"
+    "net"
+    "net/http"
+    "sync"
+    "time"
+)
+
+const (
+    minUsernameLength = 3
+    maxUsernameLength = 15
+    minPasswordLength = 8
+    maxPasswordLength = 64
+
+    // Sessions expire after 30 days (measured in seconds)
+    sessionLifetime = 60 * 60 * 24 * 30
+
+    // Each client IP may make at most loginsPerIP attempts to log in or
+    //  register per loginWindow, and each username at most loginsPerUsername
+    //  logins. Every attempt hashes a password, which is slow on purpose.
+    loginsPerIP = 30
+    loginsPerUsername = 10
+    loginWindow = 60
+)
+
+type AccountRequest struct {
+    Username string `json:"username"`
+    Password string `json:"password"`
+}
+func (ar *AccountRequest) Strings() []string {
+    return []string{ar.Username, ar.Password}
+}
+// `SessionToken` may be sent as `sessionToken` with /new-game and
+//  /request-seat to attach the user to the seat they are given
+type SessionResponse struct {
+    Username string     `json:"username"`
+    SessionToken string `json:"sessionToken"`
+    Expires Time        `json:"expires"`
+}
+type LogoutRequest struct {
+    SessionToken string `json:"sessionToken"`
+}
+
+// Counts the attempts in the current loginWindow. Windows are fixed rather
+//  than sliding, so that the counts can simply be dropped as each one ends.
+type loginLimiter struct {
+    lock sync.Mutex
+    windowStart Time
+    byIP map[string]int
+    byUsername map[string]int
+}
+
+// Expects a POST request
+func (s *server) registerHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(AccountRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+    if !s.logins.allow(clientIP(r), "") {
+        writeLoginLimited(w)
+        return
+    }
+
+    if !validUsername(request.Username) {
+        apierror.Writef(w, apierror.BadRequest,
+                        "Usernames need %d to %d letters, digits, underscores, or hyphens",
+                        minUsernameLength, maxUsernameLength)
+        return
+    }
+    if len(request.Password) < minPasswordLength || len(request.Password) > maxPasswordLength ||
+            !database.StringsAreSafe(request) {
+        apierror.Writef(w, apierror.BadRequest,
+                        "Passwords need %d to %d printable characters",
+                        minPasswordLength, maxPasswordLength)
+        return
+    }
+
+    user := new(User)
+    user.Username = request.Username
+    user.Salt = auth.NewSalt()
+    user.PasswordHash = auth.HashPassword(request.Password, user.Salt)
+    var alreadyPresent bool = true
+    for alreadyPresent {  // Ensure the user id is new
+        user.ID = random.JavaScriptFriendlyRandom64()
+        _, alreadyPresent, _ = s.store.GetUser(user.ID)
+    }
+
+    inserted, err := s.store.InsertUser(user)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not create the account")
+        return
+    } else if !inserted {
+        apierror.Write(w, apierror.BadRequest, "Username is taken")
+        return
+    }
+
+    s.startSession(w, *user)
+}
+
+// Expects a POST request
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(AccountRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+    if !s.logins.allow(clientIP(r), request.Username) {
+        writeLoginLimited(w)
+        return
+    }
+
+    user, found, err := s.store.GetUserByName(request.Username)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the account")
+        return
+    }
+    // Unknown usernames and wrong passwords look the same to the client
+    if !found || !auth.CheckPassword(request.Password, user.Salt, user.PasswordHash) {
+        apierror.Write(w, apierror.BadRequest, "Wrong username or password")
+        return
+    }
+
+    s.startSession(w, user)
+}
+
+// Expects a POST request
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(LogoutRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    err = s.store.DeleteSession(auth.HashToken(request.SessionToken))
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not end the session")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Logged out")
+}
+
+// Returns the ID of the user signed in with `token`, or 0 for an empty token.
+//
+// The bool is false if a non-empty token is unknown or has expired.
+func (s *server) sessionUser(token string) (ID, bool, error) {
+    if token == "" {
+        return 0, true, nil
+    }
+    session, found, err := s.store.GetSession(auth.HashToken(token))
+    if err != nil || !found {
+        return 0, false, err
+    }
+    return session.UserID, true, nil
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Creates a session for `user` and writes the whole response
+func (s *server) startSession(w http.ResponseWriter, user User) {
+    token := auth.NewSessionToken()
+    session := new(Session)
+    session.TokenHash = auth.HashToken(token)
+    session.UserID = user.ID
+    session.Expires = Time(time.Now().Unix() + sessionLifetime)
+    err := s.store.InsertSession(session)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not start a session")
+        return
+    }
+
+    var result SessionResponse
+    result.Username = user.Username
+    result.SessionToken = token
+    result.Expires = session.Expires
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+// Records an attempt from `ip`, and for `username` unless it is empty.
+//  Returns false, recording nothing, if either has no attempts left in the
+//  current window.
+func (l *loginLimiter) allow(ip string, username string) bool {
+    l.lock.Lock()
+    defer l.lock.Unlock()
+    now := Time(time.Now().Unix())
+    if l.byIP == nil || now - l.windowStart >= loginWindow {
+        l.windowStart = now
+        l.byIP = make(map[string]int)
+        l.byUsername = make(map[string]int)
+    }
+    if l.byIP[ip] >= loginsPerIP || (username != "" && l.byUsername[username] >= loginsPerUsername) {
+        return false
+    }
+    l.byIP[ip]++
+    if username != "" {
+        l.byUsername[username]++
+    }
+    return true
+}
+
+func writeLoginLimited(w http.ResponseWriter) {
+    apierror.Writef(w, apierror.BadRequest, "Too many attempts; try again in up to %d seconds",
+                    loginWindow)
+}
+
+// In production, requests arrive through the nginx ingress, which puts the
+//  client's address in X-Real-IP; otherwise the connection's address is the
+//  client's
+func clientIP(r *http.Request) string {
+    if ip := r.Header.Get("X-Real-IP"); ip != "" {
+        return ip
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+func validUsername(username string) bool {
+    if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+        return false
+    }
+    for _, c := range username {
+        if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+                c == '_' || c == '-') {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,182 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/gameplay"
+    "net/http"
+)
+
+// `PlayerID` must be the host's
+type KickSeatRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+    Seat int    `json:"seat"`
+}
+// `PlayerID` must be the host's. Locking stops anyone else from joining and
+//  hides the game from the lobby list.
+type LockGameRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+    Locked bool `json:"locked"`
+}
+// `PlayerID` must be the host's. With `FillWithAI`, every unclaimed human seat
+//  becomes an AI seat of strength `Difficulty`; otherwise unclaimed seats stay
+//  open to anyone with the password. Nobody plays the turns of an open seat,
+//  so a game without a clock may only start once no seat is open.
+type StartGameRequest struct {
+    GameID ID             `json:"gameID"`
+    PlayerID ID           `json:"playerID"`
+    FillWithAI bool       `json:"fillWithAI"`
+    Difficulty Difficulty `json:"difficulty"`
+}
+
+// Expects a POST request
+//
+// Removes a player from the lobby. Their seat is reopened and their player ID
+//  stops working.
+func (s *server) kickSeatHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(KickSeatRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    game, seat, ok := s.hostControlledSeat(w, request.GameID, request.PlayerID, request.Seat)
+    if !ok {
+        return
+    }
+    // Once play begins, only inactive seats may be reopened (see /reopen-seat)
+    if game.Begun {
+        apierror.Write(w, apierror.BadRequest, "Game has already begun")
+        return
+    } else if !seat.Claimed {
+        apierror.Write(w, apierror.BadRequest, "Seat is already open")
+        return
+    }
+
+    newPlayerID := s.newPlayerID()
+    reopened, err := s.store.ReopenSeat(request.GameID, request.Seat, newPlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not reopen the seat")
+        return
+    } else if !reopened {
+        apierror.Write(w, apierror.GameFull, "Seat changed -- please try again")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Player removed")
+}
+
+// Expects a POST request
+func (s *server) lockGameHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(LockGameRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if _, ok := s.checkHost(w, request.GameID, request.PlayerID); !ok {
+        return
+    }
+
+    err = s.store.SetLocked(request.GameID, request.Locked)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not lock the game")
+        return
+    }
+
+    if request.Locked {
+        apierror.Write(w, apierror.Success, "Game locked")
+    } else {
+        apierror.Write(w, apierror.Success, "Game unlocked")
+    }
+}
+
+// Expects a POST request
+//
+// Begins play without waiting for every seat to be claimed
+func (s *server) startGameHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(StartGameRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if request.FillWithAI && (request.Difficulty < Easy || request.Difficulty > Expert) {
+        apierror.Writef(w, apierror.BadRequest, "Unknown difficulty %d", request.Difficulty)
+        return
+    }
+
+    game, ok := s.checkHost(w, request.GameID, request.PlayerID)
+    if !ok {
+        return
+    } else if game.Begun {
+        apierror.Write(w, apierror.BadRequest, "Game has already begun")
+        return
+    }
+
+    empty, err := s.store.GetEmptySeats(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up empty seats")
+        return
+    }
+    if !request.FillWithAI && len(empty) > 0 {
+        spec, found, err := s.store.GetSpec(request.GameID)
+        if !found || err != nil {
+            apierror.Write(w, apierror.Overloaded, "Could not look up the game spec")
+            return
+        }
+        // Otherwise the game would wait forever on the first open seat's turn
+        if !gameplay.HasClock(spec.Spec.Clock) {
+            apierror.Write(w, apierror.BadRequest,
+                           "Games without a clock need every open seat filled with an AI to start early")
+            return
+        }
+    }
+
+    if request.FillWithAI {
+        // A seat claimed in the meantime is left to its new player
+        for _, seat := range empty {
+            _, err = s.store.ConvertSeatToAI(request.GameID, seat.Seat, false, s.newPlayerID(),
+                                             request.Difficulty)
+            if err != nil {
+                apierror.Write(w, apierror.Overloaded, "Could not convert the seats")
+                return
+            }
+        }
+    }
+
+    err = s.store.SetBegun(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not start the game")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Game started")
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Checks that `playerID` is the host of the game, writing an error response if
+//  not
+func (s *server) checkHost(w http.ResponseWriter, gameID ID, playerID ID) (Game, bool) {
+    game, found, err := s.store.GetGame(gameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return Game{}, false
+    }
+    if !found || game.HostID == 0 || game.HostID != playerID {
+        apierror.Write(w, apierror.BadRequest, "Only the host may do this")
+        return Game{}, false
+    }
+    return game, true
+}
@@ -5,29 +5,45 @@ import . "linegames/backend/internal/types"
 import (
     "encoding/json"
     "fmt"
+    "linegames/backend/internal/apierror"
     "linegames/backend/internal/database"
     "linegames/backend/internal/httpparse"
     "linegames/backend/internal/random"
+    "linegames/backend/internal/rules"
     "linegames/backend/internal/util"
     "log"
     "math/rand"
     "net/http"
     "io"
+    "time"
+    "unicode/utf8"
 )
 
 const (
     maxPlayers = 6
+    maxDisplayNameLength = 20
 )
 
 
+// `Difficulties` is optional. When present, it has one entry per seat, and the
+//  entries for AI seats set the strength of those AIs.
+//
+// `SessionToken` is optional. When present, the signed-in user is recorded on
+//  the host's seat.
+//
+// `DisplayName` labels the host's seat for the other players. It defaults to
+//  the signed-in user's username, if any.
 type CreateRequest struct {
-    Name string          `json:"name"`
-    Password string      `json:"password"`
-    SeatTypes []SeatType `json:"seatTypes"`
-    Spec GameSpec        `json:"spec"`
+    Name string               `json:"name"`
+    Password string           `json:"password"`
+    SeatTypes []SeatType      `json:"seatTypes"`
+    Difficulties []Difficulty `json:"difficulties"`
+    Spec GameSpec             `json:"spec"`
+    SessionToken string       `json:"sessionToken"`
+    DisplayName string        `json:"displayName"`
 }
 func (cr *CreateRequest) Strings() []string {
-    return []string{cr.Name, cr.Password}
+    return []string{cr.Name, cr.Password, cr.DisplayName}
 }
 type AssignedSeat struct {
     Seat int      `json:"seat"`
@@ -35,20 +51,39 @@ type AssignedSeat struct {
     Type SeatType `json:"type"`
 }
 // NOTE: `Seats` only contains the seat(s) assigned in the process of handling a
-//  particular request -- not all the seats that a client occupies.
+//  particular request -- not all the seats that a client occupies. AI seats
+//  are never assigned to clients, since the AI server plays them.
 type SuccessResponse struct {
     GameID ID            `json:"gameID"`
     Seats []AssignedSeat `json:"assignedSeats"`
     Spec GameSpec        `json:"spec"`
     NumPlayers int       `json:"numPlayers"`
 }
+// `SessionToken` and `DisplayName` are optional, as in CreateRequest
 type SeatRequest struct {
+    GameID ID           `json:"gameID"`
+    Password string     `json:"password"`
+    SessionToken string `json:"sessionToken"`
+    DisplayName string  `json:"displayName"`
+}
+func (sr *SeatRequest) Strings() []string {
+    return []string{sr.Password, sr.DisplayName}
+}
+type SpectateRequest struct {
     GameID ID       `json:"gameID"`
     Password string `json:"password"`
 }
-func (sr *SeatRequest) Strings() []string {
+func (sr *SpectateRequest) Strings() []string {
     return []string{sr.Password}
 }
+// `SpectatorID` may be used in place of a player ID on the gameplay server's
+//  read-only endpoints
+type SpectateResponse struct {
+    GameID ID       `json:"gameID"`
+    SpectatorID ID  `json:"spectatorID"`
+    Spec GameSpec   `json:"spec"`
+    NumPlayers int  `json:"numPlayers"`
+}
 type DeleteRequest struct {
     GameID ID   `json:"gameID"`
     PlayerID ID `json:"playerID"`
@@ -68,21 +103,46 @@ type AISeatsResponse struct {
     Indices []int   `json:"indices"`
 }
 
+type SeatsRequest struct {
+    GameID ID   `url:"gameID"`
+    PlayerID ID `url:"playerID"`
+}
+// `DisplayName` is empty for AI seats, unclaimed seats, and players who gave
+//  no name. `Inactive` marks claimed human seats which have stopped sending
+//  heartbeats.
+type SeatInfo struct {
+    Seat int           `json:"seat"`
+    Type SeatType      `json:"type"`
+    Claimed bool       `json:"claimed"`
+    DisplayName string `json:"displayName"`
+    Inactive bool      `json:"inactive"`
+    Host bool          `json:"host"`
+}
+type SeatsResponse struct {
+    Seats []SeatInfo `json:"seats"`
+    Locked bool      `json:"locked"`
+}
+
+type server struct {
+    store database.Store
+    logins loginLimiter
+}
+
 // Assumes that sr already has the game ID and the seat info -- adds the spec
 //  and the number of players.
-func fillInGameDetails(sr *SuccessResponse) error {
+func (s *server) fillInGameDetails(sr *SuccessResponse) error {
     var err error
     var found bool
     var game Game
     var spec Spec
-    spec, found, err = database.GetSpec(sr.GameID)
+    spec, found, err = s.store.GetSpec(sr.GameID)
     if err != nil {
         return err
     } else if !found {
         return fmt.Errorf("Game Spec for game_id %d not found.", sr.GameID)
     }
     sr.Spec = spec.Spec
-    game, found, err = database.GetGame(sr.GameID)
+    game, found, err = s.store.GetGame(sr.GameID)
     if err != nil {
         return err
     } else if !found {
@@ -92,38 +152,89 @@ func fillInGameDetails(sr *SuccessResponse) error {
     return nil
 }
 
+// Signed-in users who give no display name are shown by their username
+func (s *server) chooseDisplayName(requested string, userID ID) (string, error) {
+    if requested != "" || userID == 0 {
+        return requested, nil
+    }
+    user, found, err := s.store.GetUser(userID)
+    if err != nil || !found {
+        return "", err
+    }
+    return user.Username, nil
+}
+
 // Expects a POST request
-func newGameHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) newGameHandler(w http.ResponseWriter, r *http.Request) {
 
     newGame := new(CreateRequest)
     err := json.NewDecoder(r.Body).Decode(newGame)
     if (err != nil && err != io.EOF) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
     if !database.StringsAreSafe(newGame) {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Write(w, apierror.BadRequest, "Name, password, and display name may only contain printable characters")
+        return
+    }
+    if utf8.RuneCountInString(newGame.DisplayName) > maxDisplayNameLength {
+        apierror.Writef(w, apierror.BadRequest, "Display names may have at most %d characters", maxDisplayNameLength)
         return
     }
 
     if len(newGame.SeatTypes) == 0 || len(newGame.SeatTypes) > maxPlayers {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Writef(w, apierror.BadRequest, "Games need between 1 and %d seats", maxPlayers)
+        return
+    }
+
+    if err = rules.ValidateSpec(newGame.Spec); err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    userID, validSession, err := s.sessionUser(newGame.SessionToken)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the session")
+        return
+    } else if !validSession {
+        apierror.Write(w, apierror.BadRequest, "Unknown or expired session")
+        return
+    }
+    displayName, err := s.chooseDisplayName(newGame.DisplayName, userID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the user")
         return
     }
 
     for i := 0; i < len(newGame.SeatTypes); i++ {
         if newGame.SeatTypes[i] != Human && newGame.SeatTypes[i] != AI {
-            w.WriteHeader(http.StatusBadRequest)
+            apierror.Writef(w, apierror.BadRequest, "Unknown seat type %d", newGame.SeatTypes[i])
+            return
+        }
+    }
+
+    if len(newGame.Difficulties) == 0 {
+        newGame.Difficulties = make([]Difficulty, len(newGame.SeatTypes))
+        for i := 0; i < len(newGame.Difficulties); i++ {
+            newGame.Difficulties[i] = Medium
+        }
+    }
+    if len(newGame.Difficulties) != len(newGame.SeatTypes) {
+        apierror.Write(w, apierror.BadRequest, "Difficulties must have one entry per seat")
+        return
+    }
+    for i := 0; i < len(newGame.Difficulties); i++ {
+        if newGame.Difficulties[i] < Easy || newGame.Difficulties[i] > Expert {
+            apierror.Writef(w, apierror.BadRequest, "Unknown difficulty %d", newGame.Difficulties[i])
             return
         }
     }
 
     /// Rotate the seat types so that human vs. AI starting order is random ///
-    newGame.SeatTypes = util.Rotated[SeatType](newGame.SeatTypes,
-                                               int(rand.Int31n(int32(len(newGame.SeatTypes)))))
+    rotateAmt := int(rand.Int31n(int32(len(newGame.SeatTypes))))
+    newGame.SeatTypes = util.Rotated[SeatType](newGame.SeatTypes, rotateAmt)
+    newGame.Difficulties = util.Rotated[Difficulty](newGame.Difficulties, rotateAmt)
 
     /// First, create all the information locally ///
     g := new(Game)
@@ -135,7 +246,7 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
     var alreadyPresent bool = true
     for alreadyPresent {  // Ensure the game id is new
         g.ID = random.JavaScriptFriendlyRandom64()
-        _, alreadyPresent, _ = database.GetGame(g.ID)
+        _, alreadyPresent, _ = s.store.GetGame(g.ID)
     }
 
     playerIDs := make([]ID, g.NumPlayers)
@@ -145,7 +256,7 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
         alreadyPresent = true
         for alreadyPresent || util.Contains[ID](playerIDs, playerId) {
             playerId = random.JavaScriptFriendlyRandom64()
-            _, alreadyPresent, _ = database.GetPlayer(playerId)
+            _, alreadyPresent, _ = s.store.GetPlayer(playerId)
         }
         playerIDs[i] = playerId
         players[i].ID = playerId
@@ -154,24 +265,23 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 
     seats := make([]Seat, g.NumPlayers)
     humanSeats := make([]int, 0)
-    aiSeats := make([]int, 0)
     for i := 0; i < g.NumPlayers; i++ {
         seats[i].GameID = g.ID
         seats[i].PlayerID = playerIDs[i]
         seats[i].Seat = i
         seats[i].Type = newGame.SeatTypes[i]
+        seats[i].Difficulty = newGame.Difficulties[i]
         if seats[i].Type == Human {
             seats[i].Claimed = false
             humanSeats = append(humanSeats, i)
         } else {
             seats[i].Claimed = true
-            aiSeats = append(aiSeats, i)
         }
     }
 
     // Give the host a seat so that we can determine the host ID
     if len(humanSeats) == 0 {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Write(w, apierror.BadRequest, "Games need at least one human seat")
         return
     }
     if len(humanSeats) == 1 {
@@ -179,6 +289,11 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
     }
     hSeat := humanSeats[int(rand.Int31n(int32(len(humanSeats))))]
     seats[hSeat].Claimed = true
+    seats[hSeat].UserID = userID
+    seats[hSeat].DisplayName = displayName
+    seats[hSeat].LastSeen = Time(time.Now().Unix())
+    players[hSeat].UserID = userID
+    g.HostID = seats[hSeat].PlayerID
 
     spec := new(Spec)
     spec.GameID = g.ID
@@ -186,44 +301,20 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 
     /// Then, put the information in the database ///
 
-    err = database.InsertGame(g)
-    if (err != nil) {
-        w.WriteHeader(http.StatusServiceUnavailable)
-        return
-    }
-    err = database.InsertSpec(spec)
-    if (err != nil) {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    err = s.store.CreateGame(g, spec, players, seats)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not create the game")
         return
     }
-    for i := 0; i < g.NumPlayers; i++ {
-        err = database.InsertPlayer(&players[i])
-        if err != nil {
-            w.WriteHeader(http.StatusServiceUnavailable)
-            return
-        }
-    }
-    for i := 0; i < g.NumPlayers; i++ {
-        err = database.InsertSeat(&seats[i])
-        if err != nil {
-            w.WriteHeader(http.StatusServiceUnavailable)
-            return
-        }
-    }
 
     var result SuccessResponse
     result.GameID = g.ID
     result.NumPlayers = g.NumPlayers
     result.Spec = newGame.Spec
-    result.Seats = make([]AssignedSeat, 1 + len(aiSeats))
+    result.Seats = make([]AssignedSeat, 1)
     result.Seats[0].Seat =     seats[hSeat].Seat
     result.Seats[0].Type =     seats[hSeat].Type
     result.Seats[0].PlayerID = seats[hSeat].PlayerID
-    for i := 0; i < len(aiSeats); i++ {
-        result.Seats[i + 1].Seat =     seats[aiSeats[i]].Seat
-        result.Seats[i + 1].Type =     seats[aiSeats[i]].Type
-        result.Seats[i + 1].PlayerID = seats[aiSeats[i]].PlayerID
-    }
 
     w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
     marshalled, _ := json.Marshal(result)
@@ -231,67 +322,123 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Expects a POST request
-func deleteGameHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) deleteGameHandler(w http.ResponseWriter, r *http.Request) {
 
     toDelete := new(DeleteRequest)
     err := json.NewDecoder(r.Body).Decode(toDelete)
     if (err != nil) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
-    player, found, err := database.GetPlayer(toDelete.PlayerID)
+    player, found, err := s.store.GetPlayer(toDelete.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
     if !found || player.GameID != toDelete.GameID {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
         return
     }
+
+    err = s.store.DeleteAllGameData(toDelete.GameID)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not delete the game")
+        return
     }
 
-    database.DeleteAllGameData(toDelete.GameID)
-
-    w.WriteHeader(http.StatusOK)
+    apierror.Write(w, apierror.Success, "Game deleted")
 }
 
 // Expects a POST request
-func requestSeatHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) requestSeatHandler(w http.ResponseWriter, r *http.Request) {
 
     seatRequest := new(SeatRequest)
     err := json.NewDecoder(r.Body).Decode(seatRequest)
     if err != nil {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
     if !database.StringsAreSafe(seatRequest) {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Write(w, apierror.BadRequest, "Password and display name may only contain printable characters")
+        return
+    }
+    if utf8.RuneCountInString(seatRequest.DisplayName) > maxDisplayNameLength {
+        apierror.Writef(w, apierror.BadRequest, "Display names may have at most %d characters", maxDisplayNameLength)
         return
     }
 
     var check bool
-    check, err = database.ValidLogin(seatRequest.GameID, seatRequest.Password)
-    if err != nil || !check {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    check, err = s.store.ValidLogin(seatRequest.GameID, seatRequest.Password)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not check the password")
+        return
+    } else if !check {
+        apierror.Write(w, apierror.BadRequest, "Wrong game or password")
+        return
+    }
+    game, found, err := s.store.GetGame(seatRequest.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    } else if game.Locked {
+        apierror.Write(w, apierror.GameFull, "Game is locked")
         return
     }
 
-    var seats []Seat
-    seats, err = database.GetEmptySeats(seatRequest.GameID)
-    if err != nil || len(seats) == 0 {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    userID, validSession, err := s.sessionUser(seatRequest.SessionToken)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the session")
+        return
+    } else if !validSession {
+        apierror.Write(w, apierror.BadRequest, "Unknown or expired session")
+        return
+    }
+    displayName, err := s.chooseDisplayName(seatRequest.DisplayName, userID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the user")
+        return
+    }
+
+    var empty []Seat
+    empty, err = s.store.GetEmptySeats(seatRequest.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up empty seats")
+        return
+    }
+    // Seats of a rematch held for the previous players are not offered until
+    //  their reservations expire
+    seats := make([]Seat, 0, len(empty))
+    for _, seat := range empty {
+        if seat.ReservedUntil <= Time(time.Now().Unix()) {
+            seats = append(seats, seat)
+        }
+    }
+    if len(seats) == 0 {
+        apierror.Write(w, apierror.GameFull, "Game is full")
         return
     }
 
     chosenIdx := int(rand.Int31n(int32(len(seats))))
     seatNum := seats[chosenIdx].Seat
-    check, err = database.ClaimSeat(seatRequest.GameID, seatNum)
-    if err != nil || !check {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    check, err = s.store.ClaimSeat(seatRequest.GameID, seatNum, userID, displayName)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not claim a seat")
+        return
+    } else if !check {
+        // Someone else claimed it first
+        apierror.Write(w, apierror.GameFull, "Seat was taken -- please try again")
+        return
+    }
+
+    // Play begins once every seat is filled
+    remaining, err := s.store.GetEmptySeats(seatRequest.GameID)
+    if err == nil && len(remaining) == 0 {
+        err = s.store.SetBegun(seatRequest.GameID)
+    }
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not start the game")
         return
     }
 
@@ -300,9 +447,9 @@ func requestSeatHandler(w http.ResponseWriter, r *http.Request) {
     result.Seats = []AssignedSeat{AssignedSeat{Seat: seatNum,
                                                Type: seats[chosenIdx].Type,
                                                PlayerID: seats[chosenIdx].PlayerID}}
-    err = fillInGameDetails(&result)
+    err = s.fillInGameDetails(&result)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
         return
     }
 
@@ -311,32 +458,93 @@ func requestSeatHandler(w http.ResponseWriter, r *http.Request) {
     w.Write(marshalled)
 }
 
+// Expects a POST request
+func (s *server) spectateHandler(w http.ResponseWriter, r *http.Request) {
+
+    spectateRequest := new(SpectateRequest)
+    err := json.NewDecoder(r.Body).Decode(spectateRequest)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if !database.StringsAreSafe(spectateRequest) {
+        apierror.Write(w, apierror.BadRequest, "Password may only contain printable characters")
+        return
+    }
+
+    var check bool
+    check, err = s.store.ValidLogin(spectateRequest.GameID, spectateRequest.Password)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not check the password")
+        return
+    } else if !check {
+        apierror.Write(w, apierror.BadRequest, "Wrong game or password")
+        return
+    }
+
+    // Spectator IDs share the player IDs' namespace so that the gameplay
+    //  server can tell which kind of ID it was sent
+    spectator := new(Spectator)
+    spectator.GameID = spectateRequest.GameID
+    var alreadyPresent bool = true
+    for alreadyPresent {
+        spectator.ID = random.JavaScriptFriendlyRandom64()
+        _, alreadyPresent, _ = s.store.GetPlayer(spectator.ID)
+        if !alreadyPresent {
+            _, alreadyPresent, _ = s.store.GetSpectator(spectator.ID)
+        }
+    }
+
+    err = s.store.InsertSpectator(spectator)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not add the spectator")
+        return
+    }
+
+    var details SuccessResponse
+    details.GameID = spectateRequest.GameID
+    err = s.fillInGameDetails(&details)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    var result SpectateResponse
+    result.GameID = spectator.GameID
+    result.SpectatorID = spectator.ID
+    result.Spec = details.Spec
+    result.NumPlayers = details.NumPlayers
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
 // Expects a GET request
-func emptySeatsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) emptySeatsHandler(w http.ResponseWriter, r *http.Request) {
 
     userData := new(EmptySeatsRequest)
     err := httpparse.HttpParamsToStruct(r, userData, "url")
 
     if (err != nil) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
-    player, found, err := database.GetPlayer(userData.PlayerID)
-    if !found || player.GameID != userData.GameID {
-        w.WriteHeader(http.StatusBadRequest)
+    player, found, err := s.store.GetPlayer(userData.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
         return
     }
-    if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+    if !found || player.GameID != userData.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
         return
     }
 
-    seats, err := database.GetEmptySeats(userData.GameID)
+    seats, err := s.store.GetEmptySeats(userData.GameID)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up empty seats")
         return
     }
 
@@ -353,31 +561,80 @@ func emptySeatsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Expects a GET request
-func aiSeatsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) seatsHandler(w http.ResponseWriter, r *http.Request) {
 
-    userData := new(AISeatsRequest)
+    userData := new(SeatsRequest)
     err := httpparse.HttpParamsToStruct(r, userData, "url")
 
     if (err != nil) {
-        w.WriteHeader(http.StatusBadRequest)
-        errText, _ := json.Marshal(err.Error())
-        w.Write(errText)
+        apierror.Write(w, apierror.BadRequest, err.Error())
         return
     }
 
-    player, found, err := database.GetPlayer(userData.PlayerID)
+    player, found, err := s.store.GetPlayer(userData.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
     if !found || player.GameID != userData.GameID {
-        w.WriteHeader(http.StatusBadRequest)
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    game, found, err := s.store.GetGame(userData.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
         return
     }
+    seats, err := s.store.GetSeats(userData.GameID)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the seats")
         return
     }
 
-    seats, err := database.GetAISeats(userData.GameID)
+    var result SeatsResponse
+    result.Locked = game.Locked
+    result.Seats = make([]SeatInfo, 0, len(seats))
+    for _, seat := range seats {
+        result.Seats = append(result.Seats, SeatInfo{Seat: seat.Seat, Type: seat.Type,
+                                                     Claimed: seat.Claimed,
+                                                     DisplayName: seat.DisplayName,
+                                                     Inactive: seat.Type == Human && seat.Claimed &&
+                                                               inactive(seat),
+                                                     Host: game.HostID != 0 &&
+                                                           seat.PlayerID == game.HostID})
+    }
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    w.Header().Set("Cache-Control", "max-age=1") // set brief 1-second cache life
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+// Expects a GET request
+func (s *server) aiSeatsHandler(w http.ResponseWriter, r *http.Request) {
+
+    userData := new(AISeatsRequest)
+    err := httpparse.HttpParamsToStruct(r, userData, "url")
+
+    if (err != nil) {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(userData.PlayerID)
     if err != nil {
-        w.WriteHeader(http.StatusServiceUnavailable)
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != userData.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    seats, err := s.store.GetAISeats(userData.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up AI seats")
         return
     }
 
@@ -392,12 +649,30 @@ func aiSeatsHandler(w http.ResponseWriter, r *http.Request) {
     w.Write(marshalled)
 }
 
-func main() {
+func (s *server) routes() *http.ServeMux {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/new-game",     s.newGameHandler)
+    mux.HandleFunc("/delete-game",  s.deleteGameHandler)
+    mux.HandleFunc("/request-seat", s.requestSeatHandler)
+    mux.HandleFunc("/rematch",      s.rematchHandler)
+    mux.HandleFunc("/spectate",     s.spectateHandler)
+    mux.HandleFunc("/register",     s.registerHandler)
+    mux.HandleFunc("/login",        s.loginHandler)
+    mux.HandleFunc("/logout",       s.logoutHandler)
+    mux.HandleFunc("/heartbeat",    s.heartbeatHandler)
+    mux.HandleFunc("/reopen-seat",  s.reopenSeatHandler)
+    mux.HandleFunc("/seat-to-ai",   s.seatToAIHandler)
+    mux.HandleFunc("/reconnect",    s.reconnectHandler)
+    mux.HandleFunc("/kick-seat",    s.kickSeatHandler)
+    mux.HandleFunc("/lock-game",    s.lockGameHandler)
+    mux.HandleFunc("/start-game",   s.startGameHandler)
+    mux.HandleFunc("/seats",        s.seatsHandler)
+    mux.HandleFunc("/empty-seats",  s.emptySeatsHandler)
+    mux.HandleFunc("/ai-seats",     s.aiSeatsHandler)
+    return mux
+}
 
-    http.HandleFunc("/new-game",     newGameHandler)
-    http.HandleFunc("/delete-game",  deleteGameHandler)
-    http.HandleFunc("/request-seat", requestSeatHandler)
-    http.HandleFunc("/empty-seats",  emptySeatsHandler)
-    http.HandleFunc("/ai-seats",     aiSeatsHandler)
-    log.Fatal(http.ListenAndServe(":8080", nil))
+func main() {
+    s := &server{store: database.NewPostgresStore()}
+    log.Fatal(http.ListenAndServe(":8080", s.routes()))
 }
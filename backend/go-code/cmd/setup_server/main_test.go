@@ -0,0 +1,594 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    . "linegames/backend/internal/types"
+    "linegames/backend/internal/memstore"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func testServer() (*server, *httptest.Server) {
+    s := &server{store: memstore.New()}
+    return s, httptest.NewServer(s.routes())
+}
+
+func postJSON(t *testing.T, url string, body any, response any) int {
+    marshalled, _ := json.Marshal(body)
+    resp, err := http.Post(url, "application/json", bytes.NewReader(marshalled))
+    if err != nil {
+        t.Fatalf("POST %s failed: %v", url, err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK && response != nil {
+        if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+            t.Fatalf("Bad response from %s: %v", url, err)
+        }
+    }
+    return resp.StatusCode
+}
+
+func getJSON(t *testing.T, url string, response any) int {
+    resp, err := http.Get(url)
+    if err != nil {
+        t.Fatalf("GET %s failed: %v", url, err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK && response != nil {
+        if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+            t.Fatalf("Bad response from %s: %v", url, err)
+        }
+    }
+    return resp.StatusCode
+}
+
+func twoHumanGame() CreateRequest {
+    var cr CreateRequest
+    cr.Name = "test"
+    cr.Password = "secret"
+    cr.SeatTypes = []SeatType{Human, Human}
+    cr.Spec.Board = GameBoard{Width: 7, Height: 6, Gravity: true}
+    cr.Spec.Rules = GameRules{WinningLength: 4}
+    return cr
+}
+
+func TestNewGame(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    var created SuccessResponse
+    if code := postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if created.NumPlayers != 2 || len(created.Seats) != 1 {
+        t.Errorf("Expected 2 players and 1 assigned seat, got %+v", created)
+    }
+    game, found, _ := s.store.GetGame(created.GameID)
+    if !found || game.Name != "test" || game.Begun {
+        t.Errorf("Game not stored correctly: %+v", game)
+    }
+    spec, found, _ := s.store.GetSpec(created.GameID)
+    if !found || spec.Spec != created.Spec {
+        t.Errorf("Spec not stored correctly: %+v", spec)
+    }
+
+    bad := twoHumanGame()
+    bad.Spec.Board.Width = 0
+    if code := postJSON(t, ts.URL + "/new-game", bad, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an invalid spec, got %d", code)
+    }
+}
+
+func TestNewGameAgainstAI(t *testing.T) {
+    _, ts := testServer()
+    defer ts.Close()
+
+    request := twoHumanGame()
+    request.SeatTypes = []SeatType{Human, AI, AI}
+    request.Difficulties = []Difficulty{Easy, Hard, Expert}
+    var created SuccessResponse
+    if code := postJSON(t, ts.URL + "/new-game", request, &created); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if len(created.Seats) != 1 || created.Seats[0].Type != Human {
+        t.Errorf("Expected only the human seat to be assigned, got %+v", created.Seats)
+    }
+}
+
+func TestNewAndDeleteGame(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    request := twoHumanGame()
+    request.SeatTypes = []SeatType{Human, Human, AI}
+    var created SuccessResponse
+    if code := postJSON(t, ts.URL + "/new-game", request, &created); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    // The game is created all at once, with a player for every seat
+    seats, _ := s.store.GetSeats(created.GameID)
+    if len(seats) != 3 {
+        t.Fatalf("Expected 3 seats, got %+v", seats)
+    }
+    for _, seat := range seats {
+        if player, found, _ := s.store.GetPlayer(seat.PlayerID); !found || player.GameID != created.GameID {
+            t.Errorf("Expected a player for seat %d, got %+v", seat.Seat, player)
+        }
+    }
+
+    hostID := created.Seats[0].PlayerID
+    if code := postJSON(t, ts.URL + "/delete-game", DeleteRequest{GameID: created.GameID, PlayerID: hostID + 1},
+                        nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an unknown player, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/delete-game", DeleteRequest{GameID: created.GameID, PlayerID: hostID},
+                        nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if _, found, _ := s.store.GetGame(created.GameID); found {
+        t.Errorf("Game still stored after deletion")
+    }
+    if _, found, _ := s.store.GetSpec(created.GameID); found {
+        t.Errorf("Spec still stored after deletion")
+    }
+    if seats, _ := s.store.GetSeats(created.GameID); len(seats) != 0 {
+        t.Errorf("Seats still stored after deletion: %+v", seats)
+    }
+    for _, seat := range seats {
+        if _, found, _ := s.store.GetPlayer(seat.PlayerID); found {
+            t.Errorf("Player for seat %d still stored after deletion", seat.Seat)
+        }
+    }
+}
+
+func TestRequestSeat(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    var created SuccessResponse
+    postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created)
+
+    wrong := SeatRequest{GameID: created.GameID, Password: "wrong"}
+    if code := postJSON(t, ts.URL + "/request-seat", wrong, nil); code == http.StatusOK {
+        t.Errorf("Seat granted with the wrong password")
+    }
+
+    var joined SuccessResponse
+    right := SeatRequest{GameID: created.GameID, Password: "secret"}
+    if code := postJSON(t, ts.URL + "/request-seat", right, &joined); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if len(joined.Seats) != 1 || joined.Seats[0].Seat == created.Seats[0].Seat {
+        t.Errorf("Expected the other seat, got %+v", joined.Seats)
+    }
+    if joined.NumPlayers != 2 || joined.Spec != created.Spec {
+        t.Errorf("Game details not filled in: %+v", joined)
+    }
+    if game, _, _ := s.store.GetGame(created.GameID); !game.Begun {
+        t.Errorf("Game did not begin once every seat was claimed")
+    }
+
+    if code := postJSON(t, ts.URL + "/request-seat", right, nil); code != http.StatusConflict {
+        t.Errorf("Expected 409 for a full game, got %d", code)
+    }
+}
+
+func TestQuotesInNamesAndPasswords(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    // Values are bound as query parameters, so quotes and SQL are just text
+    request := twoHumanGame()
+    request.Name = `O'Neil's "game"`
+    request.Password = "'; DROP TABLE--"
+    var created SuccessResponse
+    if code := postJSON(t, ts.URL + "/new-game", request, &created); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if game, _, _ := s.store.GetGame(created.GameID); game.Name != request.Name {
+        t.Errorf("Expected the name %q to be stored as sent, got %q", request.Name, game.Name)
+    }
+
+    wrong := SeatRequest{GameID: created.GameID, Password: "'; DROP TABLE"}
+    if code := postJSON(t, ts.URL + "/request-seat", wrong, nil); code == http.StatusOK {
+        t.Errorf("Seat granted with the wrong password")
+    }
+    right := SeatRequest{GameID: created.GameID, Password: request.Password}
+    if code := postJSON(t, ts.URL + "/request-seat", right, nil); code != http.StatusOK {
+        t.Errorf("Expected 200 for the right password, got %d", code)
+    }
+
+    // Text which would display badly is still refused
+    request.Name = "bell\a"
+    if code := postJSON(t, ts.URL + "/new-game", request, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a control character, got %d", code)
+    }
+}
+
+func TestEmptySeats(t *testing.T) {
+    _, ts := testServer()
+    defer ts.Close()
+
+    var created SuccessResponse
+    postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created)
+    url := ts.URL + "/empty-seats?gameID=" + strconv.FormatInt(created.GameID, 10) +
+           "&playerID=" + strconv.FormatInt(created.Seats[0].PlayerID, 10)
+
+    var empty EmptySeatsResponse
+    if code := getJSON(t, url, &empty); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if len(empty.Indices) != 1 || empty.Indices[0] != 1 - created.Seats[0].Seat {
+        t.Errorf("Expected the other seat to be empty, got %v", empty.Indices)
+    }
+
+    postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: created.GameID, Password: "secret"}, nil)
+    if getJSON(t, url, &empty); len(empty.Indices) != 0 {
+        t.Errorf("Expected no empty seats, got %v", empty.Indices)
+    }
+}
+
+func TestSpectate(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    var created SuccessResponse
+    postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created)
+
+    wrong := SpectateRequest{GameID: created.GameID, Password: "wrong"}
+    if code := postJSON(t, ts.URL + "/spectate", wrong, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for the wrong password, got %d", code)
+    }
+
+    var watching SpectateResponse
+    right := SpectateRequest{GameID: created.GameID, Password: "secret"}
+    if code := postJSON(t, ts.URL + "/spectate", right, &watching); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if watching.NumPlayers != 2 || watching.Spec != created.Spec {
+        t.Errorf("Game details not filled in: %+v", watching)
+    }
+    if _, found, _ := s.store.GetPlayer(watching.SpectatorID); found {
+        t.Errorf("Spectator ID %d is also a player ID", watching.SpectatorID)
+    }
+    spectator, found, _ := s.store.GetSpectator(watching.SpectatorID)
+    if !found || spectator.GameID != created.GameID {
+        t.Errorf("Spectator not stored correctly: %+v", spectator)
+    }
+    if empty, _ := s.store.GetEmptySeats(created.GameID); len(empty) != 1 {
+        t.Errorf("Spectating should not claim a seat")
+    }
+}
+
+func TestAccounts(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    account := AccountRequest{Username: "alice", Password: "correct horse"}
+    var registered SessionResponse
+    if code := postJSON(t, ts.URL + "/register", account, &registered); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if registered.Username != "alice" || registered.SessionToken == "" {
+        t.Errorf("Bad registration response %+v", registered)
+    }
+    user, found, _ := s.store.GetUserByName("alice")
+    if !found || user.PasswordHash == "" || user.PasswordHash == account.Password {
+        t.Errorf("User not stored with a password hash: %+v", user)
+    }
+    if code := postJSON(t, ts.URL + "/register", account, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a taken username, got %d", code)
+    }
+    short := AccountRequest{Username: "bob", Password: "short"}
+    if code := postJSON(t, ts.URL + "/register", short, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a short password, got %d", code)
+    }
+
+    wrong := AccountRequest{Username: "alice", Password: "wrong horse"}
+    if code := postJSON(t, ts.URL + "/login", wrong, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for the wrong password, got %d", code)
+    }
+    var loggedIn SessionResponse
+    if code := postJSON(t, ts.URL + "/login", account, &loggedIn); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if loggedIn.SessionToken == registered.SessionToken {
+        t.Errorf("Logging in should start a new session")
+    }
+
+    // Seats claimed with a session record the user
+    var created SuccessResponse
+    postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created)
+    var joined SuccessResponse
+    join := SeatRequest{GameID: created.GameID, Password: "secret", SessionToken: loggedIn.SessionToken}
+    if code := postJSON(t, ts.URL + "/request-seat", join, &joined); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    seat, _, _ := s.store.GetSeat(created.GameID, joined.Seats[0].Seat)
+    player, _, _ := s.store.GetPlayer(joined.Seats[0].PlayerID)
+    if seat.UserID != user.ID || player.UserID != user.ID {
+        t.Errorf("Expected user %d on the seat and player, got %d and %d", user.ID, seat.UserID, player.UserID)
+    }
+    if host, _, _ := s.store.GetSeat(created.GameID, created.Seats[0].Seat); host.UserID != 0 {
+        t.Errorf("Anonymous host has user %d", host.UserID)
+    }
+
+    postJSON(t, ts.URL + "/logout", LogoutRequest{SessionToken: loggedIn.SessionToken}, nil)
+    hosted := twoHumanGame()
+    hosted.SessionToken = loggedIn.SessionToken
+    if code := postJSON(t, ts.URL + "/new-game", hosted, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a session which was logged out, got %d", code)
+    }
+}
+
+func TestLoginRateLimit(t *testing.T) {
+    _, ts := testServer()
+    defer ts.Close()
+
+    account := AccountRequest{Username: "carol", Password: "correct horse"}
+    postJSON(t, ts.URL + "/register", account, nil)
+    wrong := AccountRequest{Username: "carol", Password: "wrong horse"}
+    for i := 0; i < loginsPerUsername; i++ {
+        postJSON(t, ts.URL + "/login", wrong, nil)
+    }
+    // Even the right password is refused until the window ends
+    if code := postJSON(t, ts.URL + "/login", account, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 once the username ran out of attempts, got %d", code)
+    }
+
+    // Another username from the same address has attempts left, up to the
+    //  address's own limit
+    other := AccountRequest{Username: "dave", Password: "correct horse"}
+    if code := postJSON(t, ts.URL + "/register", other, nil); code != http.StatusOK {
+        t.Errorf("Expected 200 for another username, got %d", code)
+    }
+    // Both registrations and carol's logins used up some of them
+    for i := loginsPerUsername + 2; i < loginsPerIP; i++ {
+        guess := AccountRequest{Username: "guess" + strconv.Itoa(i), Password: "correct horse"}
+        postJSON(t, ts.URL + "/login", guess, nil)
+    }
+    if code := postJSON(t, ts.URL + "/login", other, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 once the address ran out of attempts, got %d", code)
+    }
+}
+
+func TestSeatsShowDisplayNames(t *testing.T) {
+    _, ts := testServer()
+    defer ts.Close()
+
+    hosted := twoHumanGame()
+    hosted.DisplayName = "Host"
+    var created SuccessResponse
+    postJSON(t, ts.URL + "/new-game", hosted, &created)
+    url := ts.URL + "/seats?gameID=" + strconv.FormatInt(created.GameID, 10) +
+           "&playerID=" + strconv.FormatInt(created.Seats[0].PlayerID, 10)
+
+    var seats SeatsResponse
+    if code := getJSON(t, url, &seats); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    hostSeat := created.Seats[0].Seat
+    if len(seats.Seats) != 2 || seats.Seats[hostSeat].DisplayName != "Host" ||
+            seats.Seats[1 - hostSeat].Claimed {
+        t.Errorf("Expected only the host's seat to be claimed and named, got %+v", seats.Seats)
+    }
+
+    tooLong := SeatRequest{GameID: created.GameID, Password: "secret",
+                           DisplayName: "abcdefghijklmnopqrstuvwxyz"}
+    if code := postJSON(t, ts.URL + "/request-seat", tooLong, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a long display name, got %d", code)
+    }
+
+    // Signed-in users without a display name are shown by their username
+    var session SessionResponse
+    postJSON(t, ts.URL + "/register", AccountRequest{Username: "guest", Password: "password1"}, &session)
+    join := SeatRequest{GameID: created.GameID, Password: "secret", SessionToken: session.SessionToken}
+    postJSON(t, ts.URL + "/request-seat", join, nil)
+    getJSON(t, url, &seats)
+    if !seats.Seats[1 - hostSeat].Claimed || seats.Seats[1 - hostSeat].DisplayName != "guest" {
+        t.Errorf("Expected the guest's seat to be claimed and named, got %+v", seats.Seats[1 - hostSeat])
+    }
+}
+
+func TestRematch(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    var created, joined SuccessResponse
+    postJSON(t, ts.URL + "/new-game", twoHumanGame(), &created)
+    postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: created.GameID, Password: "secret"}, &joined)
+    host := RematchRequest{GameID: created.GameID, PlayerID: created.Seats[0].PlayerID}
+    guest := RematchRequest{GameID: created.GameID, PlayerID: joined.Seats[0].PlayerID}
+
+    if code := postJSON(t, ts.URL + "/rematch", host, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 before the game is over, got %d", code)
+    }
+    s.store.InsertResult(&Result{GameID: created.GameID, Winner: 0, Line: []Position{}})
+
+    var hostRematch SuccessResponse
+    if code := postJSON(t, ts.URL + "/rematch", host, &hostRematch); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if hostRematch.GameID == created.GameID || hostRematch.Spec != created.Spec {
+        t.Errorf("Expected a new game with the same spec, got %+v", hostRematch)
+    }
+    if hostRematch.Seats[0].Seat != (created.Seats[0].Seat + 1) % 2 {
+        t.Errorf("Expected the host's seat to rotate, got seat %d", hostRematch.Seats[0].Seat)
+    }
+    if code := postJSON(t, ts.URL + "/rematch", host, nil); code != http.StatusConflict {
+        t.Errorf("Expected 409 for a second rematch request, got %d", code)
+    }
+
+    // The guest's seat is held for them
+    stranger := SeatRequest{GameID: hostRematch.GameID, Password: "secret"}
+    if code := postJSON(t, ts.URL + "/request-seat", stranger, nil); code != http.StatusConflict {
+        t.Errorf("Expected 409 for a reserved seat, got %d", code)
+    }
+
+    var guestRematch SuccessResponse
+    if code := postJSON(t, ts.URL + "/rematch", guest, &guestRematch); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if guestRematch.GameID != hostRematch.GameID || guestRematch.Seats[0].Seat == hostRematch.Seats[0].Seat {
+        t.Errorf("Expected the other seat of the same rematch, got %+v", guestRematch)
+    }
+    if game, _, _ := s.store.GetGame(hostRematch.GameID); !game.Begun {
+        t.Errorf("Rematch did not begin once every seat was claimed")
+    }
+}
+
+// Stores a begun three-seat game whose host is seat 0. Seat 1 was last seen
+//  long ago, and seat 2 belongs to the user `userID`.
+func gameWithAbsentSeat(t *testing.T, s *server, userID ID) Game {
+    g := Game{ID: 10, NumPlayers: 3, Begun: true, Name: "test", Password: "secret", HostID: 20}
+    spec := Spec{GameID: g.ID, Spec: twoHumanGame().Spec}
+    players := []Player{{ID: 20, GameID: g.ID}, {ID: 21, GameID: g.ID}, {ID: 22, GameID: g.ID, UserID: userID}}
+    now := Time(time.Now().Unix())
+    seats := make([]Seat, 3)
+    for i := range seats {
+        seats[i] = Seat{GameID: g.ID, Seat: i, Type: Human, Claimed: true,
+                        PlayerID: players[i].ID, LastSeen: now}
+    }
+    seats[1].LastSeen = now - 10 * seatInactiveAfter
+    seats[2].UserID = userID
+    if err := s.store.CreateGame(&g, &spec, players, seats); err != nil {
+        t.Fatalf("Could not create the game: %v", err)
+    }
+    return g
+}
+
+func TestReopenSeat(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+    g := gameWithAbsentSeat(t, s, 0)
+
+    if code := postJSON(t, ts.URL + "/heartbeat", HeartbeatRequest{GameID: g.ID, PlayerID: 22}, nil); code != http.StatusOK {
+        t.Errorf("Expected 200 for a heartbeat, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/reopen-seat", ReopenSeatRequest{GameID: g.ID, PlayerID: 22, Seat: 1}, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 when a guest reopens a seat, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/reopen-seat", ReopenSeatRequest{GameID: g.ID, PlayerID: 20, Seat: 2}, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for reopening an active seat, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/reopen-seat", ReopenSeatRequest{GameID: g.ID, PlayerID: 20, Seat: 1}, nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+
+    // The absent player's ID no longer works, and someone else may take the seat
+    if code := postJSON(t, ts.URL + "/heartbeat", HeartbeatRequest{GameID: g.ID, PlayerID: 21}, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for the replaced player ID, got %d", code)
+    }
+    var joined SuccessResponse
+    if code := postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: g.ID, Password: "secret"}, &joined); code != http.StatusOK {
+        t.Fatalf("Expected 200 for claiming the reopened seat, got %d", code)
+    }
+    if joined.Seats[0].Seat != 1 || joined.Seats[0].PlayerID == 21 {
+        t.Errorf("Expected seat 1 with a new player ID, got %+v", joined.Seats[0])
+    }
+}
+
+func TestSeatToAI(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+    g := gameWithAbsentSeat(t, s, 0)
+
+    request := SeatToAIRequest{GameID: g.ID, PlayerID: 20, Seat: 1, Difficulty: Hard}
+    if code := postJSON(t, ts.URL + "/seat-to-ai", request, nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    seat, _, _ := s.store.GetSeat(g.ID, 1)
+    if seat.Type != AI || seat.Difficulty != Hard || seat.PlayerID == 21 {
+        t.Errorf("Seat not handed to an AI: %+v", seat)
+    }
+    if code := postJSON(t, ts.URL + "/seat-to-ai", request, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for converting an AI seat, got %d", code)
+    }
+}
+
+func TestReconnect(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    var session SessionResponse
+    postJSON(t, ts.URL + "/register", AccountRequest{Username: "player", Password: "password1"}, &session)
+    user, _, _ := s.store.GetUserByName("player")
+    g := gameWithAbsentSeat(t, s, user.ID)
+
+    var reconnected SuccessResponse
+    request := ReconnectRequest{GameID: g.ID, SessionToken: session.SessionToken}
+    if code := postJSON(t, ts.URL + "/reconnect", request, &reconnected); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if len(reconnected.Seats) != 1 || reconnected.Seats[0].PlayerID != 22 || reconnected.NumPlayers != 3 {
+        t.Errorf("Expected the user's seat, got %+v", reconnected)
+    }
+    if code := postJSON(t, ts.URL + "/reconnect", ReconnectRequest{GameID: g.ID}, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 without a session, got %d", code)
+    }
+}
+
+func TestHostControls(t *testing.T) {
+    s, ts := testServer()
+    defer ts.Close()
+
+    threeHumans := twoHumanGame()
+    threeHumans.SeatTypes = []SeatType{Human, Human, Human}
+    var created, joined SuccessResponse
+    postJSON(t, ts.URL + "/new-game", threeHumans, &created)
+    postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: created.GameID, Password: "secret"}, &joined)
+    host := created.Seats[0].PlayerID
+    guest := joined.Seats[0].PlayerID
+    if game, _, _ := s.store.GetGame(created.GameID); game.HostID != host {
+        t.Errorf("Expected the creator to host, got host %d", game.HostID)
+    }
+
+    kick := KickSeatRequest{GameID: created.GameID, PlayerID: guest, Seat: created.Seats[0].Seat}
+    if code := postJSON(t, ts.URL + "/kick-seat", kick, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 when a guest kicks, got %d", code)
+    }
+    kick = KickSeatRequest{GameID: created.GameID, PlayerID: host, Seat: joined.Seats[0].Seat}
+    if code := postJSON(t, ts.URL + "/kick-seat", kick, nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/heartbeat", HeartbeatRequest{GameID: created.GameID, PlayerID: guest}, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for a kicked player's ID, got %d", code)
+    }
+
+    lock := LockGameRequest{GameID: created.GameID, PlayerID: host, Locked: true}
+    if code := postJSON(t, ts.URL + "/lock-game", lock, nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    if code := postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: created.GameID, Password: "secret"}, nil); code != http.StatusConflict {
+        t.Errorf("Expected 409 for a locked game, got %d", code)
+    }
+    lock.Locked = false
+    postJSON(t, ts.URL + "/lock-game", lock, nil)
+    if code := postJSON(t, ts.URL + "/request-seat", SeatRequest{GameID: created.GameID, Password: "secret"}, nil); code != http.StatusOK {
+        t.Errorf("Expected 200 once unlocked, got %d", code)
+    }
+
+    // Without a clock, nobody would ever play the open seat's turns
+    start := StartGameRequest{GameID: created.GameID, PlayerID: host}
+    if code := postJSON(t, ts.URL + "/start-game", start, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for leaving a seat open without a clock, got %d", code)
+    }
+    start = StartGameRequest{GameID: created.GameID, PlayerID: host, FillWithAI: true, Difficulty: Easy}
+    if code := postJSON(t, ts.URL + "/start-game", start, nil); code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d", code)
+    }
+    game, _, _ := s.store.GetGame(created.GameID)
+    aiSeats, _ := s.store.GetAISeats(created.GameID)
+    empty, _ := s.store.GetEmptySeats(created.GameID)
+    if !game.Begun || len(aiSeats) != 1 || len(empty) != 0 {
+        t.Errorf("Expected a begun game with the open seat given to an AI, got %+v with %d AI seats",
+                 game, len(aiSeats))
+    }
+    if code := postJSON(t, ts.URL + "/start-game", start, nil); code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for starting twice, got %d", code)
+    }
+}
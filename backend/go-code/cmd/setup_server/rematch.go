@@ -0,0 +1,224 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "fmt"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/random"
+    "linegames/backend/internal/util"
+    "net/http"
+    "time"
+)
+
+const (
+    // Seats of a rematch are held for the previous players for 2 minutes
+    //  (measured in seconds), after which anyone with the password may claim
+    //  them
+    rematchReservation = 60 * 2
+)
+
+type RematchRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+}
+
+// Expects a POST request
+//
+// The first player to ask creates the rematch; each player who asks is given
+//  the seat reserved for them, and play begins once every seat is claimed.
+func (s *server) rematchHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(RematchRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    _, over, err := s.store.GetResult(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's result")
+        return
+    } else if !over {
+        apierror.Write(w, apierror.BadRequest, "Game is not over yet")
+        return
+    }
+
+    game, found, err := s.store.GetGame(request.GameID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+    previousSeat, found, err := s.store.GetPlayerSeat(request.PlayerID)
+    if !found || err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player's seat")
+        return
+    }
+
+    rematchID := game.RematchID
+    if rematchID == 0 {
+        created, err := s.createRematch(game)
+        if err != nil {
+            apierror.Write(w, apierror.Overloaded, "Could not create the rematch")
+            return
+        }
+        rematchID, err = s.store.SetRematch(game.ID, created)
+        if err != nil {
+            apierror.Write(w, apierror.Overloaded, "Could not record the rematch")
+            return
+        }
+        if rematchID != created {
+            // Another player created a rematch first
+            s.store.DeleteAllGameData(created)
+        }
+    }
+
+    seats, err := s.store.GetSeats(rematchID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the rematch's seats")
+        return
+    }
+    var reserved Seat
+    found = false
+    for _, seat := range seats {
+        if seat.ReservedFor == request.PlayerID {
+            reserved = seat
+            found = true
+        }
+    }
+    if !found {
+        apierror.Write(w, apierror.GameFull, "Rematch is no longer available")
+        return
+    }
+
+    // Once a reservation expires, the seat may have gone to someone else, so a
+    //  claimed seat is never handed out again
+    claimed, err := s.store.ClaimSeat(rematchID, reserved.Seat, previousSeat.UserID,
+                                      previousSeat.DisplayName)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not claim a seat")
+        return
+    } else if !claimed {
+        apierror.Write(w, apierror.GameFull, "Reserved seat was already claimed")
+        return
+    }
+
+    // Play begins once every seat is filled
+    remaining, err := s.store.GetEmptySeats(rematchID)
+    if err == nil && len(remaining) == 0 {
+        err = s.store.SetBegun(rematchID)
+    }
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not start the game")
+        return
+    }
+
+    var result SuccessResponse
+    result.GameID = rematchID
+    result.Seats = []AssignedSeat{AssignedSeat{Seat: reserved.Seat, Type: reserved.Type,
+                                               PlayerID: reserved.PlayerID}}
+    err = s.fillInGameDetails(&result)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Creates a game with the same name, password, spec, and seats as `previous`,
+//  with the seats rotated by one so that a different seat starts. Each human
+//  seat is reserved for the player who held it before the rotation.
+//
+// Returns the new game's ID.
+func (s *server) createRematch(previous Game) (ID, error) {
+    spec, found, err := s.store.GetSpec(previous.ID)
+    if err != nil {
+        return 0, err
+    } else if !found {
+        return 0, fmt.Errorf("Game Spec for game_id %d not found.", previous.ID)
+    }
+    previousSeats, err := s.store.GetSeats(previous.ID)
+    if err != nil {
+        return 0, err
+    }
+
+    seatTypes := make([]SeatType, len(previousSeats))
+    difficulties := make([]Difficulty, len(previousSeats))
+    previousPlayers := make([]ID, len(previousSeats))
+    for i, seat := range previousSeats {
+        seatTypes[i] = seat.Type
+        difficulties[i] = seat.Difficulty
+        previousPlayers[i] = seat.PlayerID
+    }
+    seatTypes = util.Rotated[SeatType](seatTypes, 1)
+    difficulties = util.Rotated[Difficulty](difficulties, 1)
+    previousPlayers = util.Rotated[ID](previousPlayers, 1)
+
+    g := new(Game)
+    g.Name     = previous.Name
+    g.Password = previous.Password
+    g.NumPlayers = len(seatTypes)
+    g.Begun = false
+
+    var alreadyPresent bool = true
+    for alreadyPresent {  // Ensure the game id is new
+        g.ID = random.JavaScriptFriendlyRandom64()
+        _, alreadyPresent, _ = s.store.GetGame(g.ID)
+    }
+
+    playerIDs := make([]ID, g.NumPlayers)
+    players   := make([]Player, g.NumPlayers)
+    var playerId ID
+    for i := 0; i < g.NumPlayers; i++ {
+        alreadyPresent = true
+        for alreadyPresent || util.Contains[ID](playerIDs, playerId) {
+            playerId = random.JavaScriptFriendlyRandom64()
+            _, alreadyPresent, _ = s.store.GetPlayer(playerId)
+        }
+        playerIDs[i] = playerId
+        players[i].ID = playerId
+        players[i].GameID = g.ID
+    }
+
+    reservedUntil := Time(time.Now().Unix() + rematchReservation)
+    seats := make([]Seat, g.NumPlayers)
+    for i := 0; i < g.NumPlayers; i++ {
+        seats[i].GameID = g.ID
+        seats[i].PlayerID = playerIDs[i]
+        seats[i].Seat = i
+        seats[i].Type = seatTypes[i]
+        seats[i].Difficulty = difficulties[i]
+        seats[i].Claimed = seats[i].Type == AI
+        if seats[i].Type == Human {
+            seats[i].ReservedFor = previousPlayers[i]
+            seats[i].ReservedUntil = reservedUntil
+        }
+        // The previous host hosts the rematch too
+        if previous.HostID != 0 && previousPlayers[i] == previous.HostID {
+            g.HostID = playerIDs[i]
+        }
+    }
+
+    newSpec := new(Spec)
+    newSpec.GameID = g.ID
+    newSpec.Spec = spec.Spec
+
+    return g.ID, s.store.CreateGame(g, newSpec, players, seats)
+}
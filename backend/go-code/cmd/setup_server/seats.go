@@ -0,0 +1,262 @@
+package main
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "encoding/json"
+    "linegames/backend/internal/apierror"
+    "linegames/backend/internal/random"
+    "net/http"
+    "time"
+)
+
+const (
+    // Clients send a heartbeat every 15 seconds or so; a seat which has sent
+    //  none for a minute (measured in seconds) counts as inactive
+    seatInactiveAfter = 60
+)
+
+type HeartbeatRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+}
+// `PlayerID` must be the host's
+type ReopenSeatRequest struct {
+    GameID ID   `json:"gameID"`
+    PlayerID ID `json:"playerID"`
+    Seat int    `json:"seat"`
+}
+// `PlayerID` must be the host's
+type SeatToAIRequest struct {
+    GameID ID             `json:"gameID"`
+    PlayerID ID           `json:"playerID"`
+    Seat int              `json:"seat"`
+    Difficulty Difficulty `json:"difficulty"`
+}
+type ReconnectRequest struct {
+    GameID ID           `json:"gameID"`
+    SessionToken string `json:"sessionToken"`
+}
+
+// Expects a POST request
+func (s *server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(HeartbeatRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    player, found, err := s.store.GetPlayer(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the player")
+        return
+    }
+    if !found || player.GameID != request.GameID {
+        apierror.Write(w, apierror.BadRequest, "Unknown player for this game")
+        return
+    }
+
+    err = s.store.TouchSeat(request.PlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not record the heartbeat")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Heartbeat recorded")
+}
+
+// Expects a POST request
+//
+// Empties an inactive seat so that anyone with the password may claim it. The
+//  seat's old player ID stops working.
+func (s *server) reopenSeatHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(ReopenSeatRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    _, seat, ok := s.hostControlledSeat(w, request.GameID, request.PlayerID, request.Seat)
+    if !ok {
+        return
+    }
+    if !seat.Claimed {
+        apierror.Write(w, apierror.BadRequest, "Seat is already open")
+        return
+    } else if !inactive(seat) {
+        apierror.Write(w, apierror.BadRequest, "Seat is still active")
+        return
+    }
+
+    newPlayerID := s.newPlayerID()
+    reopened, err := s.store.ReopenSeat(request.GameID, request.Seat, newPlayerID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not reopen the seat")
+        return
+    } else if !reopened {
+        apierror.Write(w, apierror.GameFull, "Seat changed -- please try again")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Seat reopened")
+}
+
+// Expects a POST request
+//
+// Hands an open or inactive seat to an AI. Play begins if this fills the last
+//  open seat.
+func (s *server) seatToAIHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(SeatToAIRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    if request.Difficulty < Easy || request.Difficulty > Expert {
+        apierror.Writef(w, apierror.BadRequest, "Unknown difficulty %d", request.Difficulty)
+        return
+    }
+
+    _, seat, ok := s.hostControlledSeat(w, request.GameID, request.PlayerID, request.Seat)
+    if !ok {
+        return
+    }
+    if seat.Claimed && !inactive(seat) {
+        apierror.Write(w, apierror.BadRequest, "Seat is still active")
+        return
+    }
+
+    newPlayerID := s.newPlayerID()
+    converted, err := s.store.ConvertSeatToAI(request.GameID, request.Seat, seat.Claimed,
+                                              newPlayerID, request.Difficulty)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not convert the seat")
+        return
+    } else if !converted {
+        apierror.Write(w, apierror.GameFull, "Seat changed -- please try again")
+        return
+    }
+
+    // Play begins once every seat is filled
+    remaining, err := s.store.GetEmptySeats(request.GameID)
+    if err == nil && len(remaining) == 0 {
+        err = s.store.SetBegun(request.GameID)
+    }
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not start the game")
+        return
+    }
+
+    apierror.Write(w, apierror.Success, "Seat handed to an AI")
+}
+
+// Expects a POST request
+//
+// Gives a signed-in user back the seats they hold in the game, for instance
+//  after switching devices.
+func (s *server) reconnectHandler(w http.ResponseWriter, r *http.Request) {
+
+    request := new(ReconnectRequest)
+    err := json.NewDecoder(r.Body).Decode(request)
+    if err != nil {
+        apierror.Write(w, apierror.BadRequest, err.Error())
+        return
+    }
+
+    userID, validSession, err := s.sessionUser(request.SessionToken)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the session")
+        return
+    } else if !validSession || userID == 0 {
+        apierror.Write(w, apierror.BadRequest, "Unknown or expired session")
+        return
+    }
+
+    seats, err := s.store.GetSeats(request.GameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the seats")
+        return
+    }
+
+    var result SuccessResponse
+    result.GameID = request.GameID
+    result.Seats = []AssignedSeat{}
+    for _, seat := range seats {
+        if seat.Claimed && seat.UserID == userID {
+            result.Seats = append(result.Seats, AssignedSeat{Seat: seat.Seat, Type: seat.Type,
+                                                             PlayerID: seat.PlayerID})
+        }
+    }
+    if len(result.Seats) == 0 {
+        apierror.Write(w, apierror.BadRequest, "No seat of this game belongs to the user")
+        return
+    }
+    err = s.fillInGameDetails(&result)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game")
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    marshalled, _ := json.Marshal(result)
+    w.Write(marshalled)
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Checks that `playerID` is the host of the unfinished game and that `seatNum`
+//  is another human seat of it, writing an error response if not
+func (s *server) hostControlledSeat(w http.ResponseWriter, gameID ID, playerID ID,
+                                    seatNum int) (Game, Seat, bool) {
+    game, ok := s.checkHost(w, gameID, playerID)
+    if !ok {
+        return Game{}, Seat{}, false
+    }
+
+    _, over, err := s.store.GetResult(gameID)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the game's result")
+        return Game{}, Seat{}, false
+    } else if over {
+        apierror.Write(w, apierror.GameOver, "Game is over")
+        return Game{}, Seat{}, false
+    }
+
+    seat, found, err := s.store.GetSeat(gameID, seatNum)
+    if err != nil {
+        apierror.Write(w, apierror.Overloaded, "Could not look up the seat")
+        return Game{}, Seat{}, false
+    }
+    if !found || seat.Type != Human {
+        apierror.Writef(w, apierror.BadRequest, "Seat %d is not a human seat", seatNum)
+        return Game{}, Seat{}, false
+    } else if seat.PlayerID == playerID {
+        apierror.Write(w, apierror.BadRequest, "The host's own seat cannot be changed")
+        return Game{}, Seat{}, false
+    }
+    return game, seat, true
+}
+
+func inactive(seat Seat) bool {
+    return seat.LastSeen + seatInactiveAfter <= Time(time.Now().Unix())
+}
+
+// Player IDs share their namespace with spectator IDs, so neither may be used
+func (s *server) newPlayerID() ID {
+    var playerID ID
+    var alreadyPresent bool = true
+    for alreadyPresent {
+        playerID = random.JavaScriptFriendlyRandom64()
+        _, alreadyPresent, _ = s.store.GetPlayer(playerID)
+        if !alreadyPresent {
+            _, alreadyPresent, _ = s.store.GetSpectator(playerID)
+        }
+    }
+    return playerID
+}
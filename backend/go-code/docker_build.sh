@@ -24,3 +24,13 @@ docker push                        justushibshman/jih_personal:setup_server-0.2.
 # docker tag      gameplay_server:0.1.17 justushibshman/jih_personal:gameplay_server-0.1.17
 # minikube image load justushibshman/jih_personal:gameplay_server-0.1.17
 # docker push                        justushibshman/jih_personal:gameplay_server-0.1.17
+
+# docker build --target ai-server -t ai_server:0.1.0 .
+# docker tag      ai_server:0.1.0 justushibshman/jih_personal:ai_server-0.1.0
+# minikube image load justushibshman/jih_personal:ai_server-0.1.0
+# docker push                        justushibshman/jih_personal:ai_server-0.1.0
+
+# docker build --target migrate -t migrate:0.1.0 .
+# docker tag      migrate:0.1.0 justushibshman/jih_personal:migrate-0.1.0
+# minikube image load justushibshman/jih_personal:migrate-0.1.0
+# docker push                        justushibshman/jih_personal:migrate-0.1.0
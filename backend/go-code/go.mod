@@ -4,4 +4,4 @@ replace linegames/backend => ./
 
 go 1.22.2
 
-require github.com/lib/pq v1.10.9 // indirect
+require github.com/lib/pq v1.10.9
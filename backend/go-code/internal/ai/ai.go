@@ -0,0 +1,34 @@
+package ai
+
+// Move selection for AI seats
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "linegames/backend/internal/rules"
+    "time"
+)
+
+var ErrNoLegalMoves = errors.New("No legal moves available")
+
+type AIPlayer interface {
+    // Picks a move for the seat whose turn it is on `board`.
+    //
+    // Must not modify `board`.
+    ChooseMove(board *rules.Board) (Position, error)
+}
+
+// Returns the AI used for seats of difficulty `d`
+func ForDifficulty(d Difficulty) AIPlayer {
+    switch d {
+    case Easy:
+        return new(RandomPlayer)
+    case Hard:
+        return &MinimaxPlayer{Depth: 3, Breadth: 12}
+    case Expert:
+        return &MCTSPlayer{Budget: 2 * time.Second, MaxIterations: 5000}
+    default:
+        return new(GreedyPlayer)
+    }
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+    . "linegames/backend/internal/types"
+    "linegames/backend/internal/rules"
+    "testing"
+    "time"
+)
+
+func ticTacToe(moves []Move) *rules.Board {
+    var spec GameSpec
+    spec.Board = GameBoard{Width: 3, Height: 3, Gravity: false}
+    spec.Rules = GameRules{WinningLength: 3}
+    b, _ := rules.Replay(spec, 2, moves)
+    return b
+}
+
+// The AIs expected to find wins and blocks
+func strongPlayers() map[string]AIPlayer {
+    return map[string]AIPlayer{
+        "greedy":  new(GreedyPlayer),
+        "minimax": &MinimaxPlayer{Depth: 3, Breadth: 12},
+        "mcts":    &MCTSPlayer{Budget: 100 * time.Millisecond, MaxIterations: 500},
+    }
+}
+
+func TestTakesWin(t *testing.T) {
+    b := ticTacToe([]Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 0, Y: 1},
+        Move{Turn: 2, X: 1, Y: 0},
+        Move{Turn: 3, X: 1, Y: 1},
+    })
+    for name, player := range strongPlayers() {
+        choice, err := player.ChooseMove(b)
+        if err != nil || choice != (Position{X: 2, Y: 0}) {
+            t.Errorf("%s: Expected winning move (2, 0), got %v %v", name, choice, err)
+        }
+    }
+}
+
+func TestBlocksWin(t *testing.T) {
+    b := ticTacToe([]Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 1, Y: 1},
+        Move{Turn: 2, X: 2, Y: 2},
+        Move{Turn: 3, X: 0, Y: 1},
+    })
+    for name, player := range strongPlayers() {
+        choice, err := player.ChooseMove(b)
+        if err != nil || choice != (Position{X: 2, Y: 1}) {
+            t.Errorf("%s: Expected blocking move (2, 1), got %v %v", name, choice, err)
+        }
+    }
+}
+
+func TestRandomIsLegal(t *testing.T) {
+    b := ticTacToe([]Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 1, Y: 1},
+    })
+    for i := 0; i < 20; i++ {
+        choice, err := new(RandomPlayer).ChooseMove(b)
+        if err != nil || b.CheckLegal(choice.X, choice.Y) != nil {
+            t.Errorf("Expected a legal move, got %v %v", choice, err)
+        }
+    }
+}
+
+func TestForDifficulty(t *testing.T) {
+    b := ticTacToe([]Move{})
+    for d := Easy; d <= Expert; d++ {
+        if _, ok := ForDifficulty(d).(*MCTSPlayer); ok {
+            continue  // Too slow to run for every difficulty
+        }
+        choice, err := ForDifficulty(d).ChooseMove(b)
+        if err != nil || b.CheckLegal(choice.X, choice.Y) != nil {
+            t.Errorf("Difficulty %d: Expected a legal move, got %v %v", d, choice, err)
+        }
+    }
+}
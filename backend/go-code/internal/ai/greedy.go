@@ -0,0 +1,38 @@
+package ai
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "linegames/backend/internal/rules"
+    "math/rand"
+)
+
+// Takes an immediate win if there is one, otherwise blocks the next player's
+//  immediate win, otherwise plays the move which best extends its own lines
+//  and blocks its opponents' lines
+type GreedyPlayer struct{}
+
+func (gp *GreedyPlayer) ChooseMove(board *rules.Board) (Position, error) {
+    candidates := candidateMoves(board)
+    if len(candidates) == 0 {
+        return Position{}, ErrNoLegalMoves
+    }
+
+    if p, found := forcedMove(board, candidates); found {
+        return p, nil
+    }
+
+    bestScore := -1
+    best := make([]Position, 0)
+    for _, p := range candidates {
+        score := moveScore(board, p)
+        if score > bestScore {
+            bestScore = score
+            best = best[:0]
+        }
+        if score == bestScore {
+            best = append(best, p)
+        }
+    }
+    return best[rand.Intn(len(best))], nil
+}
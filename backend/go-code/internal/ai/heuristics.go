@@ -0,0 +1,193 @@
+package ai
+
+// Board evaluation shared by the AI players
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "linegames/backend/internal/rules"
+)
+
+const (
+    candidateRadius = 2  // How far from existing stones to look for moves
+    winScore = 1 << 30   // Larger than any heuristic score
+)
+
+// Vertical, horizontal, and the two diagonals
+var directions = [4][2]int{ {0, 1}, {1, 0}, {1, 1}, {1, -1} }
+
+// The legal moves worth considering: cells within `candidateRadius` of an
+//  existing stone, or the center of an empty board.
+//
+// On gravity boards there are at most `width` legal moves, so all of them are
+//  candidates.
+func candidateMoves(board *rules.Board) []Position {
+    legal := board.LegalMoves()
+    if board.Spec.Board.Gravity {
+        return legal
+    }
+    if board.Placed == 0 {
+        center := Position{X: board.Spec.Board.Width / 2, Y: board.Spec.Board.Height / 2}
+        if board.CheckLegal(center.X, center.Y) == nil {
+            return []Position{center}
+        }
+        return legal
+    }
+
+    candidates := make([]Position, 0)
+    for _, p := range legal {
+        if hasNeighbor(board, p, candidateRadius) {
+            candidates = append(candidates, p)
+        }
+    }
+    if len(candidates) == 0 {
+        return legal
+    }
+    return candidates
+}
+
+func hasNeighbor(board *rules.Board, p Position, radius int) bool {
+    for dy := -radius; dy <= radius; dy++ {
+        for dx := -radius; dx <= radius; dx++ {
+            x := p.X + dx
+            y := p.Y + dy
+            if board.InBounds(x, y) && board.Cells[y][x] != rules.Empty {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// True if `player` placing a stone at `p` would win the game
+func winsFor(board *rules.Board, p Position, player int) bool {
+    trial := board.Copy()
+    // Skip ahead to `player`'s turn without changing the board
+    for trial.Player() != player {
+        trial.Turn++
+    }
+    if _, err := trial.Play(p.X, p.Y); err != nil {
+        return false
+    }
+    return trial.Winner == player
+}
+
+// Finds a winning move for the player whose turn it is or, failing that, a
+//  move that blocks the next player's winning move
+func forcedMove(board *rules.Board, candidates []Position) (Position, bool) {
+    me := board.Player()
+    for _, p := range candidates {
+        if winsFor(board, p, me) {
+            return p, true
+        }
+    }
+    next := (me + 1) % board.NumPlayers
+    if next != me {
+        for _, p := range candidates {
+            if winsFor(board, p, next) {
+                return p, true
+            }
+        }
+    }
+    return Position{}, false
+}
+
+// How much a stone of `player`'s at the empty cell `p` would extend their
+//  lines, with longer and more open lines counting for more
+func threatScore(board *rules.Board, p Position, player int) int {
+    score := 0
+    for _, d := range directions {
+        length := 1
+        openEnds := 0
+        for sign := -1; sign < 2; sign += 2 {
+            x := p.X + d[0] * sign
+            y := p.Y + d[1] * sign
+            for board.InBounds(x, y) && board.Cells[y][x] == player {
+                length++
+                x += d[0] * sign
+                y += d[1] * sign
+            }
+            if board.InBounds(x, y) && board.Cells[y][x] == rules.Empty {
+                openEnds++
+            }
+        }
+        if openEnds > 0 || length >= board.Spec.Rules.WinningLength {
+            score += length * length * (openEnds + 1)
+        }
+    }
+    return score
+}
+
+// Higher is better for the player whose turn it is: extending their own lines,
+//  blocking the next player's lines, and closeness to the center
+func moveScore(board *rules.Board, p Position) int {
+    me := board.Player()
+    score := 4 * threatScore(board, p, me)
+    for i := 1; i < board.NumPlayers; i++ {
+        opponent := (me + i) % board.NumPlayers
+        weight := 3
+        if i > 1 {
+            weight = 2  // Players further away can be blocked later
+        }
+        score += weight * threatScore(board, p, opponent)
+    }
+    w := board.Spec.Board.Width
+    h := board.Spec.Board.Height
+    distance := abs(2 * p.X - (w - 1)) + abs(2 * p.Y - (h - 1))
+    return 4 * (w + h) * score + (2 * (w + h) - distance)
+}
+
+// Sums, over every window of `WinningLength` cells, a weight that grows with
+//  the number of `player`'s stones in windows no other player has entered
+func lineScore(board *rules.Board, player int) int {
+    length := board.Spec.Rules.WinningLength
+    score := 0
+    for y := 0; y < board.Spec.Board.Height; y++ {
+        for x := 0; x < board.Spec.Board.Width; x++ {
+            for _, d := range directions {
+                xEnd := x + d[0] * (length - 1)
+                yEnd := y + d[1] * (length - 1)
+                if !board.InBounds(xEnd, yEnd) {
+                    continue
+                }
+                count := 0
+                for k := 0; k < length; k++ {
+                    c := board.Cells[y + d[1] * k][x + d[0] * k]
+                    if c == player {
+                        count++
+                    } else if c != rules.Empty {
+                        count = -1
+                        break
+                    }
+                }
+                if count > 0 {
+                    score += count * count * count
+                }
+            }
+        }
+    }
+    return score
+}
+
+// Static evaluation of `board` from the point of view of `player`
+func evaluate(board *rules.Board, player int) int {
+    if board.Winner == player {
+        return winScore
+    } else if board.Winner != rules.NoWinner {
+        return -winScore
+    }
+    best := 0
+    for p := 0; p < board.NumPlayers; p++ {
+        if p != player {
+            best = max(best, lineScore(board, p) + 10 * board.Captures[p])
+        }
+    }
+    return lineScore(board, player) + 10 * board.Captures[player] - best
+}
+
+func abs(x int) int {
+    if x < 0 {
+        return -x
+    }
+    return x
+}
@@ -0,0 +1,143 @@
+package ai
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "linegames/backend/internal/rules"
+    "math"
+    "math/rand"
+    "time"
+)
+
+const (
+    explorationWeight = 1.4
+    // Playouts which have not ended after this many turns count as draws
+    maxPlayoutTurns = 40
+)
+
+// Monte Carlo tree search with UCT selection and random playouts
+type MCTSPlayer struct {
+    Budget time.Duration  // Time allowed per move
+    MaxIterations int     // Playouts allowed per move (0 = unlimited)
+}
+
+type mctsNode struct {
+    move Position
+    mover int  // The seat which played `move`
+    parent *mctsNode
+    children []*mctsNode
+    untried []Position
+    visits int
+    wins float64  // From the point of view of `mover`
+}
+
+func (mp *MCTSPlayer) ChooseMove(board *rules.Board) (Position, error) {
+    candidates := candidateMoves(board)
+    if len(candidates) == 0 {
+        return Position{}, ErrNoLegalMoves
+    }
+    if p, found := forcedMove(board, candidates); found {
+        return p, nil
+    }
+
+    root := new(mctsNode)
+    root.mover = rules.NoWinner
+    root.untried = candidates
+    deadline := time.Now().Add(mp.Budget)
+    for i := 0; mp.MaxIterations == 0 || i < mp.MaxIterations; i++ {
+        if i > 0 && time.Now().After(deadline) {
+            break
+        }
+        mp.iterate(root, board.Copy())
+    }
+
+    best := root.children[0]
+    for _, child := range root.children {
+        if child.visits > best.visits {
+            best = child
+        }
+    }
+    return best.move, nil
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// One round of selection, expansion, simulation, and backpropagation.
+//
+// `board` is the position at `root` and is modified.
+func (mp *MCTSPlayer) iterate(root *mctsNode, board *rules.Board) {
+    node := root
+    for len(node.untried) == 0 && len(node.children) > 0 {
+        node = node.bestChild()
+        board.Play(node.move.X, node.move.Y)
+    }
+
+    if len(node.untried) > 0 && !board.GameOver() {
+        i := rand.Intn(len(node.untried))
+        p := node.untried[i]
+        node.untried[i] = node.untried[len(node.untried) - 1]
+        node.untried = node.untried[:len(node.untried) - 1]
+
+        child := new(mctsNode)
+        child.move = p
+        child.mover = board.Player()
+        child.parent = node
+        board.Play(p.X, p.Y)
+        if !board.GameOver() {
+            child.untried = candidateMoves(board)
+        }
+        node.children = append(node.children, child)
+        node = child
+    }
+
+    winner := playout(board)
+    for ; node != nil; node = node.parent {
+        node.visits++
+        if winner == rules.NoWinner {
+            node.wins += 1 / float64(board.NumPlayers)
+        } else if winner == node.mover {
+            node.wins += 1
+        }
+    }
+}
+
+func (n *mctsNode) bestChild() *mctsNode {
+    var best *mctsNode
+    bestValue := math.Inf(-1)
+    logVisits := math.Log(float64(n.visits))
+    for _, child := range n.children {
+        value := child.wins / float64(child.visits) +
+                 explorationWeight * math.Sqrt(logVisits / float64(child.visits))
+        if value > bestValue {
+            bestValue = value
+            best = child
+        }
+    }
+    return best
+}
+
+// Plays random moves near existing stones until the game ends or
+//  `maxPlayoutTurns` pass, then returns the winner (or NoWinner)
+func playout(board *rules.Board) int {
+    pool := candidateMoves(board)
+    for turns := 0; turns < maxPlayoutTurns && !board.GameOver() && len(pool) > 0; {
+        i := rand.Intn(len(pool))
+        p := pool[i]
+        if board.CheckLegal(p.X, p.Y) != nil {
+            // Occupied since it was added to the pool
+            pool[i] = pool[len(pool) - 1]
+            pool = pool[:len(pool) - 1]
+            continue
+        }
+        board.Play(p.X, p.Y)
+        turns++
+        for dy := -1; dy < 2; dy++ {
+            for dx := -1; dx < 2; dx++ {
+                if board.CheckLegal(p.X + dx, p.Y + dy) == nil {
+                    pool = append(pool, Position{X: p.X + dx, Y: p.Y + dy})
+                }
+            }
+        }
+    }
+    return board.Winner
+}
@@ -0,0 +1,93 @@
+package ai
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "linegames/backend/internal/rules"
+    "math"
+    "sort"
+)
+
+// Depth-limited minimax with alpha-beta pruning.
+//
+// With more than two players the search is "paranoid": every opponent is
+//  assumed to play against the searching seat.
+type MinimaxPlayer struct {
+    Depth int    // Number of turns to look ahead
+    Breadth int  // Number of most promising moves searched per turn (0 = all)
+}
+
+func (mp *MinimaxPlayer) ChooseMove(board *rules.Board) (Position, error) {
+    moves := mp.orderedMoves(board)
+    if len(moves) == 0 {
+        return Position{}, ErrNoLegalMoves
+    }
+
+    me := board.Player()
+    best := moves[0]
+    alpha := math.MinInt
+    for _, p := range moves {
+        child := board.Copy()
+        child.Play(p.X, p.Y)
+        score := mp.search(child, mp.Depth - 1, alpha, math.MaxInt, me)
+        if score > alpha {
+            alpha = score
+            best = p
+        }
+    }
+    return best, nil
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+func (mp *MinimaxPlayer) search(board *rules.Board, depth int,
+                                alpha int, beta int, me int) int {
+    if board.Winner != rules.NoWinner {
+        // Prefer quicker wins and slower losses
+        if board.Winner == me {
+            return winScore + depth
+        }
+        return -winScore - depth
+    }
+    if board.IsFull() {
+        return 0
+    }
+    if depth <= 0 {
+        return evaluate(board, me)
+    }
+
+    maximizing := board.Player() == me
+    for _, p := range mp.orderedMoves(board) {
+        child := board.Copy()
+        child.Play(p.X, p.Y)
+        score := mp.search(child, depth - 1, alpha, beta, me)
+        if maximizing {
+            alpha = max(alpha, score)
+        } else {
+            beta = min(beta, score)
+        }
+        if alpha >= beta {
+            break
+        }
+    }
+    if maximizing {
+        return alpha
+    }
+    return beta
+}
+
+// Candidate moves sorted from most to least promising, limited to `Breadth`
+func (mp *MinimaxPlayer) orderedMoves(board *rules.Board) []Position {
+    moves := candidateMoves(board)
+    scores := make(map[Position]int, len(moves))
+    for _, p := range moves {
+        scores[p] = moveScore(board, p)
+    }
+    sort.SliceStable(moves, func(i, j int) bool {
+        return scores[moves[i]] > scores[moves[j]]
+    })
+    if mp.Breadth > 0 && len(moves) > mp.Breadth {
+        moves = moves[:mp.Breadth]
+    }
+    return moves
+}
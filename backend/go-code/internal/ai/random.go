@@ -0,0 +1,19 @@
+package ai
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "linegames/backend/internal/rules"
+    "math/rand"
+)
+
+// Plays a uniformly random legal move
+type RandomPlayer struct{}
+
+func (rp *RandomPlayer) ChooseMove(board *rules.Board) (Position, error) {
+    legal := board.LegalMoves()
+    if len(legal) == 0 {
+        return Position{}, ErrNoLegalMoves
+    }
+    return legal[rand.Intn(len(legal))], nil
+}
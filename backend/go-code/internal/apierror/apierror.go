@@ -0,0 +1,55 @@
+package apierror
+
+// Error responses in the RequestStatus shape described in
+//  json_templates/sub_types/RequestStatus.txt, shared by every server so that
+//  clients can tell a full game from a finished one from an overloaded server
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+)
+
+type Status int
+
+const (
+    Success    Status = 0
+    GameFull   Status = 1
+    GameOver   Status = 2
+    BadRequest Status = 3  // Incorrectly formatted or otherwise invalid
+    Overloaded Status = 4  // Includes the database being unreachable
+    MoveConflict Status = 5  // A different move was already made for the turn
+)
+
+type RequestStatus struct {
+    Success bool   `json:"success"`
+    Status Status  `json:"status"`
+    Message string `json:"message"`
+}
+
+// The HTTP status code sent along with each Status
+func (s Status) HTTPStatus() int {
+    switch s {
+    case Success:
+        return http.StatusOK
+    case GameFull, GameOver, MoveConflict:
+        return http.StatusConflict
+    case Overloaded:
+        return http.StatusServiceUnavailable
+    default:
+        return http.StatusBadRequest
+    }
+}
+
+// Writes the whole response, so the handler must not write anything else
+func Write(w http.ResponseWriter, status Status, message string) {
+    w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
+    w.WriteHeader(status.HTTPStatus())
+    marshalled, _ := json.Marshal(RequestStatus{Success: status == Success,
+                                                Status: status, Message: message})
+    w.Write(marshalled)
+}
+
+func Writef(w http.ResponseWriter, status Status, format string, args ...any) {
+    Write(w, status, fmt.Sprintf(format, args...))
+}
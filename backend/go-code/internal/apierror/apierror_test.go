@@ -0,0 +1,30 @@
+package apierror
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestWrite(t *testing.T) {
+    recorder := httptest.NewRecorder()
+    Write(recorder, GameFull, "Game is full")
+    if recorder.Code != http.StatusConflict {
+        t.Errorf("Expected 409, got %d", recorder.Code)
+    }
+    var status RequestStatus
+    if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+        t.Fatalf("Bad body %q: %v", recorder.Body.String(), err)
+    }
+    if status != (RequestStatus{Success: false, Status: GameFull, Message: "Game is full"}) {
+        t.Errorf("Wrong status %+v", status)
+    }
+
+    recorder = httptest.NewRecorder()
+    Writef(recorder, Success, "Deleted game %d", 7)
+    json.Unmarshal(recorder.Body.Bytes(), &status)
+    if recorder.Code != http.StatusOK || !status.Success || status.Message != "Deleted game 7" {
+        t.Errorf("Wrong success response %d %+v", recorder.Code, status)
+    }
+}
@@ -0,0 +1,84 @@
+package auth
+
+// Password hashing and session tokens for user accounts
+//
+// Passwords are stored as salted PBKDF2-HMAC-SHA256 hashes. Session tokens are
+//  random and only their SHA-256 hashes are stored, so a leaked table yields
+//  neither passwords nor usable sessions.
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/binary"
+    "encoding/hex"
+)
+
+const (
+    saltBytes  = 16
+    tokenBytes = 32
+    iterations = 100000
+)
+
+// A new random salt, hex encoded
+func NewSalt() string {
+    return randomHex(saltBytes)
+}
+
+// A new random session token, hex encoded
+func NewSessionToken() string {
+    return randomHex(tokenBytes)
+}
+
+// The hex encoded hash of `password` with `salt`
+func HashPassword(password string, salt string) string {
+    return hex.EncodeToString(pbkdf2([]byte(password), []byte(salt), iterations, sha256.Size))
+}
+
+// True if `password` with `salt` hashes to `hash`, compared in constant time
+func CheckPassword(password string, salt string, hash string) bool {
+    computed := HashPassword(password, salt)
+    return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// The hex encoded hash under which a session token is stored
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+func randomHex(n int) string {
+    b := make([]byte, n)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// PBKDF2 as specified in RFC 8018, section 5.2, with HMAC-SHA256 as the PRF
+func pbkdf2(password []byte, salt []byte, iter int, keyLen int) []byte {
+    prf := hmac.New(sha256.New, password)
+    numBlocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+    key := make([]byte, 0, numBlocks * prf.Size())
+    counter := make([]byte, 4)
+    for block := 1; block <= numBlocks; block++ {
+        prf.Reset()
+        prf.Write(salt)
+        binary.BigEndian.PutUint32(counter, uint32(block))
+        prf.Write(counter)
+        u := prf.Sum(nil)
+        t := append([]byte{}, u...)
+        for i := 1; i < iter; i++ {
+            prf.Reset()
+            prf.Write(u)
+            u = prf.Sum(u[:0])
+            for j := range t {
+                t[j] ^= u[j]
+            }
+        }
+        key = append(key, t...)
+    }
+    return key[:keyLen]
+}
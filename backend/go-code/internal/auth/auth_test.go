@@ -0,0 +1,54 @@
+package auth
+
+import (
+    "encoding/hex"
+    "testing"
+)
+
+// Test vectors from RFC 7914, section 11. The second runs enough iterations
+//  to catch mistakes in chaining one iteration to the next.
+func TestPBKDF2(t *testing.T) {
+    tests := []struct {
+        password string
+        salt string
+        iterations int
+        expected string
+    }{
+        {"passwd", "salt", 1,
+         "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+         "49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+        {"Password", "NaCl", 80000,
+         "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+         "a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+    }
+    for _, test := range tests {
+        key := pbkdf2([]byte(test.password), []byte(test.salt), test.iterations, 64)
+        if hex.EncodeToString(key) != test.expected {
+            t.Errorf("Wrong key for %d iterations: %x", test.iterations, key)
+        }
+    }
+}
+
+func TestCheckPassword(t *testing.T) {
+    salt := NewSalt()
+    hash := HashPassword("hunter22", salt)
+    if !CheckPassword("hunter22", salt, hash) {
+        t.Errorf("Correct password rejected")
+    }
+    if CheckPassword("hunter23", salt, hash) {
+        t.Errorf("Wrong password accepted")
+    }
+    if CheckPassword("hunter22", NewSalt(), hash) {
+        t.Errorf("Password accepted with a different salt")
+    }
+}
+
+func TestSessionTokens(t *testing.T) {
+    token := NewSessionToken()
+    if token == NewSessionToken() || len(token) != 2 * tokenBytes {
+        t.Errorf("Tokens should be distinct and %d hex digits", 2 * tokenBytes)
+    }
+    if HashToken(token) != HashToken(token) || HashToken(token) == token {
+        t.Errorf("Token hashes should be deterministic and differ from the token")
+    }
+}
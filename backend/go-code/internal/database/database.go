@@ -10,18 +10,24 @@ import (
     "database/sql"
     "strings"
     "time"
+    "unicode"
+    "unicode/utf8"
 )
 
 type WithStrings interface {
     Strings() []string
 }
 
+// All queries bind their values as parameters, so this only needs to keep out
+//  text which would display badly (control characters, invalid UTF-8, etc.)
 func StringsAreSafe(val WithStrings) bool {
     strings := val.Strings()
     for _, s := range strings {
+        if !utf8.ValidString(s) {
+            return false
+        }
         for _, c := range s {
-            if (!(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
-                  ('0' <= c && c <= '9') ||  ' ' == c)) {
+            if !unicode.IsPrint(c) {
                 return false
             }
         }
@@ -35,215 +41,680 @@ type StringifiedSpec struct {
     SpecString string
 }
 
-// TODO: Remove the possibility of a SQL injection
-
-func GetTime() (string, bool, error) {
+func (ps *PostgresStore) GetTime() (string, bool, error) {
     return singletonQuery[string]("SELECT CURRENT_TIME;", stringScanner)
 }
 
-func ValidLogin(gameID ID, password string) (bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM games WHERE game_id = %d AND pwd = '%s';", gameID, password)
-    _, found, err := singletonQuery[Game](queryStr, gameScanner)
+func (ps *PostgresStore) ValidLogin(gameID ID, password string) (bool, error) {
+    _, found, err := singletonQuery[Game]("SELECT * FROM games WHERE game_id = $1 AND pwd = $2;",
+                                          gameScanner, gameID, password)
     return found, err
 }
 
-func GetNonBegunGames() ([]Game, error) {
+func (ps *PostgresStore) GetNonBegunGames() ([]Game, error) {
     return query[Game]("SELECT * FROM games WHERE begun = FALSE;", gameScanner)
 }
 
-func SetBegun(gameID ID) error {
-    command := fmt.Sprintf("UPDATE games SET begun = true WHERE game_id = %d;", gameID)
-    _, err := dbconn.Exec(command)
+// Also records when the game began, unless it had already begun
+func (ps *PostgresStore) SetBegun(gameID ID) error {
+    _, err := dbconn.Exec("UPDATE games SET begun = true, begun_at = $2 WHERE game_id = $1 AND begun = FALSE;",
+                          gameID, time.Now().Unix())
     return err
 }
 
 // Returns true if this query caused `claimed` to be set to true
-func ClaimSeat(gameID ID, seat int) (bool, error) {
-    command := fmt.Sprintf("UPDATE seats SET claimed = true WHERE game_id = %d AND seat = %d;", gameID, seat)
-    result, err := dbconn.Exec(command)
-    if err != nil {
-        return false, err
-    }
-    ra, err2 := result.RowsAffected()
-    return ra > 0, err2
+func (ps *PostgresStore) ClaimSeat(gameID ID, seat int, userID ID, displayName string) (bool, error) {
+    var claimed bool
+    err := dbconn.Transaction(func(tx *sql.Tx) error {
+        var playerID ID
+        err := tx.QueryRow(`UPDATE seats SET claimed = true, user_id = $3, display_name = $4,
+                                             last_seen = $5
+                            WHERE game_id = $1 AND seat = $2 AND claimed = FALSE
+                            RETURNING player_id;`, gameID, seat, userID, displayName,
+                            time.Now().Unix()).Scan(&playerID)
+        if err == sql.ErrNoRows {
+            return nil
+        } else if err != nil {
+            return err
+        }
+        _, err = tx.Exec("UPDATE players SET user_id = $1 WHERE player_id = $2;", userID, playerID)
+        if err != nil {
+            return err
+        }
+        claimed = true
+        return notifyGame(tx, gameID)
+    })
+    return claimed && err == nil, err
 }
 
-func RefreshGameTimestamp(gameID ID) error {
-    command := fmt.Sprintf("UPDATE games SET timestamp = %d WHERE game_id = %d;",
-                            time.Now().Unix(), gameID)
-    _, err := dbconn.Exec(command)
+func (ps *PostgresStore) RefreshGameTimestamp(gameID ID) error {
+    _, err := dbconn.Exec("UPDATE games SET timestamp = $1 WHERE game_id = $2;",
+                          time.Now().Unix(), gameID)
     return err
 }
 
-func DeleteAllGameData(gameID ID) error {
-    // Delete in this order so that no REFERENCES relationships are broken
-    errors := make([]error, 0)
-    err := deleteFn("seats",  "game_id", gameID)
-    if err != nil {
-        errors = append(errors, err)
-    }
-    err = deleteFn("moves",   "game_id", gameID)
-    if err != nil {
-        errors = append(errors, err)
-    }
-    err = deleteFn("players", "game_id", gameID)
-    if err != nil {
-        errors = append(errors, err)
+func (ps *PostgresStore) SetLocked(gameID ID, locked bool) error {
+    _, err := dbconn.Exec("UPDATE games SET locked = $1 WHERE game_id = $2;", locked, gameID)
+    return err
+}
+
+// Makes `hostID` the game's host, or leaves the game without one if it is 0
+func (ps *PostgresStore) SetHost(gameID ID, hostID ID) error {
+    _, err := dbconn.Exec("UPDATE games SET host_id = $1 WHERE game_id = $2;", hostID, gameID)
+    return err
+}
+
+func (ps *PostgresStore) TouchSeat(playerID ID) error {
+    _, err := dbconn.Exec("UPDATE seats SET last_seen = $1 WHERE player_id = $2;",
+                          time.Now().Unix(), playerID)
+    return err
+}
+
+// The inverse of ClaimSeat: empties a claimed human seat and hands it the new
+//  player ID `newPlayerID`, so that the previous occupant's ID stops working.
+//  Returns true if this call emptied the seat.
+func (ps *PostgresStore) ReopenSeat(gameID ID, seat int, newPlayerID ID) (bool, error) {
+    return replaceSeatPlayer(gameID, seat, newPlayerID, "claimed = TRUE",
+                             "claimed = FALSE, user_id = 0, display_name = '', last_seen = 0")
+}
+
+// Turns a human seat into an AI seat held by the new player ID `newPlayerID`,
+//  as long as whether it is claimed still matches `claimed`. Returns true if
+//  this call converted the seat.
+func (ps *PostgresStore) ConvertSeatToAI(gameID ID, seat int, claimed bool, newPlayerID ID,
+                                         difficulty Difficulty) (bool, error) {
+    condition := "claimed = FALSE"
+    if claimed {
+        condition = "claimed = TRUE"
     }
-    err = deleteFn("specs",   "game_id", gameID)
+    return replaceSeatPlayer(gameID, seat, newPlayerID, condition,
+                             "type = $3, claimed = TRUE, user_id = 0, display_name = '', difficulty = $4, last_seen = 0",
+                             AI, difficulty)
+}
+
+// Records `rematchID` as the game's rematch unless it already has one, and
+//  returns whichever rematch ID is recorded
+func (ps *PostgresStore) SetRematch(gameID ID, rematchID ID) (ID, error) {
+    _, err := dbconn.Exec("UPDATE games SET rematch_id = $2 WHERE game_id = $1 AND rematch_id = 0;",
+                          gameID, rematchID)
     if err != nil {
-        errors = append(errors, err)
+        return 0, err
     }
-    err = deleteFn("games",  "game_id", gameID)
-    if err != nil {
-        errors = append(errors, err)
+    game, found, err := ps.GetGame(gameID)
+    if err == nil && !found {
+        err = fmt.Errorf("Game for game_id %d not found.", gameID)
     }
-    if len(errors) == 0 {
+    return game.RematchID, err
+}
+
+// Tables holding a game's data, in an order for deletion which breaks no
+//  REFERENCES relationships
+var gameDataTables = []string{"game_actions", "chat_messages", "spectators", "results", "seats", "moves", "players", "specs", "games"}
+
+// Deletes every row belonging to the game, or nothing if any deletion fails
+func (ps *PostgresStore) DeleteAllGameData(gameID ID) error {
+    return dbconn.Transaction(func(tx *sql.Tx) error {
+        for _, table := range gameDataTables {
+            err := deleteFn(tx, table, "game_id", gameID)
+            if err != nil {
+                return err
+            }
+        }
         return nil
-    }
-    errString := errors[0].Error()
-    for i := 1; i < len(errors); i++ {
-        errString = errString + " | " + errors[i].Error()
-    }
-    return fmt.Errorf(errString)
+    })
 }
 
 // Get games that have existed for duration `d` or longer
-func GetOldGames(d Duration, begun bool) ([]Game, error) {
+func (ps *PostgresStore) GetOldGames(d Duration, begun bool) ([]Game, error) {
+    var now Time = Time(time.Now().Unix())
+    then := now - Time(d)
+    return query[Game]("SELECT * FROM games WHERE timestamp <= $1 AND begun = $2;",
+                       gameScanner, then, begun)
+}
+
+// Get finished games whose result was recorded duration `d` or longer ago
+func (ps *PostgresStore) GetOldFinishedGames(d Duration) ([]Game, error) {
     var now Time = Time(time.Now().Unix())
     then := now - Time(d)
-    queryStr := fmt.Sprintf("SELECT * FROM games WHERE timestamp <= %d AND begun = %t;",
-                            then, begun)
-    return query[Game](queryStr, gameScanner)
+    return query[Game]("SELECT games.* FROM games JOIN results ON games.game_id = results.game_id WHERE results.timestamp <= $1;",
+                       gameScanner, then)
 }
 
-func GetGame(gameID ID) (Game, bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM games WHERE game_id = %d;", gameID)
-    return singletonQuery[Game](queryStr, gameScanner)
+func (ps *PostgresStore) GetGame(gameID ID) (Game, bool, error) {
+    return singletonQuery[Game]("SELECT * FROM games WHERE game_id = $1;", gameScanner, gameID)
 }
 
-func GetSpec(gameID ID) (Spec, bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM specs WHERE game_id = %d;", gameID)
-    return singletonQuery[Spec](queryStr, specScanner)
+func (ps *PostgresStore) GetSpec(gameID ID) (Spec, bool, error) {
+    return singletonQuery[Spec]("SELECT * FROM specs WHERE game_id = $1;", specScanner, gameID)
 }
 
-func GetPlayer(playerID ID) (Player, bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM players WHERE player_id = %d;", playerID)
-    return singletonQuery[Player](queryStr, playerScanner)
+func (ps *PostgresStore) GetPlayer(playerID ID) (Player, bool, error) {
+    return singletonQuery[Player]("SELECT * FROM players WHERE player_id = $1;", playerScanner, playerID)
 }
 
-func GetPlayerSeat(playerID ID) (Seat, bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM seats WHERE player_id = %d;", playerID)
-    return singletonQuery[Seat](queryStr, seatScanner)
+func (ps *PostgresStore) GetPlayerSeat(playerID ID) (Seat, bool, error) {
+    return singletonQuery[Seat]("SELECT * FROM seats WHERE player_id = $1;", seatScanner, playerID)
 }
 
-func GetPlayers(gameID ID) ([]Player, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM players WHERE game_id = %d;", gameID)
-    return query[Player](queryStr, playerScanner)
+func (ps *PostgresStore) GetSeat(gameID ID, seat int) (Seat, bool, error) {
+    return singletonQuery[Seat]("SELECT * FROM seats WHERE game_id = $1 AND seat = $2;",
+                                seatScanner, gameID, seat)
 }
 
-func GetMove(gameID ID, turn int) (Move, bool, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM moves WHERE game_id = %d AND turn = %d;", gameID, turn)
-    return singletonQueryAllowMultiples[Move](queryStr, moveScanner)
+func (ps *PostgresStore) GetPlayers(gameID ID) ([]Player, error) {
+    return query[Player]("SELECT * FROM players WHERE game_id = $1;", playerScanner, gameID)
+}
+
+func (ps *PostgresStore) GetSpectator(spectatorID ID) (Spectator, bool, error) {
+    return singletonQuery[Spectator]("SELECT * FROM spectators WHERE spectator_id = $1;",
+                                     spectatorScanner, spectatorID)
+}
+
+func (ps *PostgresStore) GetMove(gameID ID, turn int) (Move, bool, error) {
+    return singletonQuery[Move]("SELECT * FROM moves WHERE game_id = $1 AND turn = $2;",
+                                moveScanner, gameID, turn)
+}
+
+// Returns every move of the game sorted by turn
+func (ps *PostgresStore) GetAllMoves(gameID ID) ([]Move, error) {
+    return query[Move]("SELECT * FROM moves WHERE game_id = $1 ORDER BY turn, id;", moveScanner, gameID)
+}
+
+// Returns at most `limit` moves (any number if `limit` <= 0) sorted by turn,
+//  starting from `fromTurn`
+func (ps *PostgresStore) GetMoves(gameID ID, fromTurn int, limit int) ([]Move, error) {
+    var maxRows any = limit
+    if limit <= 0 {
+        maxRows = nil  // LIMIT NULL means no limit
+    }
+    return query[Move]("SELECT * FROM moves WHERE game_id = $1 AND turn >= $2 ORDER BY turn LIMIT $3;",
+                       moveScanner, gameID, fromTurn, maxRows)
+}
+
+func (ps *PostgresStore) GetResult(gameID ID) (Result, bool, error) {
+    return singletonQuery[Result]("SELECT * FROM results WHERE game_id = $1;", resultScanner, gameID)
+}
+
+// Returns the game's actions sorted by ID, starting after ID `afterID`
+func (ps *PostgresStore) GetGameActions(gameID ID, afterID uint) ([]GameAction, error) {
+    return query[GameAction]("SELECT * FROM game_actions WHERE game_id = $1 AND id > $2 ORDER BY id;",
+                             gameActionScanner, gameID, afterID)
+}
+
+// Returns at most `limit` messages sorted by ID, starting after ID `afterID`
+func (ps *PostgresStore) GetChatMessages(gameID ID, afterID uint, limit int) ([]ChatMessage, error) {
+    return query[ChatMessage]("SELECT * FROM chat_messages WHERE game_id = $1 AND id > $2 ORDER BY id LIMIT $3;",
+                              chatMessageScanner, gameID, afterID, limit)
+}
+
+// Counts the messages sent from the seat within the last duration `d`
+func (ps *PostgresStore) CountRecentChatMessages(gameID ID, seat int, d Duration) (int, error) {
+    var now Time = Time(time.Now().Unix())
+    then := now - Time(d)
+    count, _, err := singletonQuery[int]("SELECT COUNT(*) FROM chat_messages WHERE game_id = $1 AND seat = $2 AND timestamp > $3;",
+                                         intScanner, gameID, seat, then)
+    return count, err
+}
+
+func (ps *PostgresStore) GetUser(userID ID) (User, bool, error) {
+    return singletonQuery[User]("SELECT * FROM users WHERE user_id = $1;", userScanner, userID)
+}
+
+func (ps *PostgresStore) GetUserByName(username string) (User, bool, error) {
+    return singletonQuery[User]("SELECT * FROM users WHERE username = $1;", userScanner, username)
+}
+
+// Only finds sessions which have not expired
+func (ps *PostgresStore) GetSession(tokenHash string) (Session, bool, error) {
+    return singletonQuery[Session]("SELECT * FROM sessions WHERE token_hash = $1 AND expires > $2;",
+                                   sessionScanner, tokenHash, time.Now().Unix())
+}
+
+// Get begun, unfinished games in which the seat due to play the next turn is an
+//  AI
+func (ps *PostgresStore) GetGamesAwaitingAI() ([]Game, error) {
+    queryStr := `SELECT games.* FROM games JOIN seats ON games.game_id = seats.game_id
+                 WHERE seats.type = $1
+                   AND games.begun
+                   AND NOT EXISTS (SELECT 1 FROM results WHERE results.game_id = games.game_id)
+                   AND seats.seat = (SELECT COUNT(DISTINCT turn) FROM moves
+                                     WHERE moves.game_id = games.game_id) % games.num_players;`
+    return query[Game](queryStr, gameScanner, AI)
+}
+
+// Returns every seat of the game sorted by seat index
+func (ps *PostgresStore) GetSeats(gameID ID) ([]Seat, error) {
+    return query[Seat]("SELECT * FROM seats WHERE game_id = $1 ORDER BY seat;", seatScanner, gameID)
+}
+
+func (ps *PostgresStore) GetEmptySeats(gameID ID) ([]Seat, error) {
+    return query[Seat]("SELECT * FROM seats WHERE game_id = $1 AND claimed = FALSE;", seatScanner, gameID)
+}
+
+func (ps *PostgresStore) GetAISeats(gameID ID) ([]Seat, error) {
+    return query[Seat]("SELECT * FROM seats WHERE game_id = $1 AND type = $2;", seatScanner, gameID, AI)
+}
+
+func (ps *PostgresStore) InsertGame(game *Game) error {
+    return insert[Game](dbconn.Pool, "games", game, gameValuesFormatter)
+}
+
+func (ps *PostgresStore) InsertSpec(spec *Spec) error {
+    return insert[Spec](dbconn.Pool, "specs", spec, specValuesFormatter)
+}
+
+func (ps *PostgresStore) InsertPlayer(player *Player) error {
+    return insert[Player](dbconn.Pool, "players", player, playerValuesFormatter)
+}
+
+func (ps *PostgresStore) InsertSpectator(spectator *Spectator) error {
+    return insert[Spectator](dbconn.Pool, "spectators", spectator, spectatorValuesFormatter)
+}
+
+func (ps *PostgresStore) InsertSeat(seat *Seat) error {
+    return insert[Seat](dbconn.Pool, "seats", seat, seatValuesFormatter)
+}
+
+// Returns true if this call stored the move, and false if a move for the same
+//  turn of the game was already stored. Otherwise returns ErrGameOver without
+//  storing anything if the game already has a result. A non-nil `result` is
+//  stored in the same transaction as the move.
+func (ps *PostgresStore) InsertMoveIfAbsent(move *Move, result *Result) (bool, error) {
+    values, err := moveValuesFormatter(move)
+    if err != nil {
+        return false, err
+    }
+    command := fmt.Sprintf("INSERT INTO moves VALUES (%s) ON CONFLICT (game_id, turn) DO NOTHING;",
+                           placeholders(values))
+    var inserted bool
+    err = dbconn.Transaction(func(tx *sql.Tx) error {
+        // Held until the transaction ends, so no result can be stored between
+        //  the check below and the commit
+        err := lockGame(tx, move.GameID)
+        if err != nil {
+            return err
+        }
+        res, err := tx.Exec(command, nonDefaults(values)...)
+        if err != nil {
+            return err
+        }
+        ra, err := res.RowsAffected()
+        if err != nil || ra == 0 {
+            return err
+        }
+        over, err := hasResult(tx, move.GameID)
+        if err != nil {
+            return err
+        } else if over {
+            return ErrGameOver  // Rolls the move back
+        }
+        if result != nil {
+            if _, err = insertResult(tx, result); err != nil {
+                return err
+            }
+        }
+        inserted = true
+        return notifyGame(tx, move.GameID)
+    })
+    return inserted && err == nil, err
+}
+
+// Inserts all of a new game's rows, or none of them if any insertion fails
+func (ps *PostgresStore) CreateGame(game *Game, spec *Spec, players []Player, seats []Seat) error {
+    return dbconn.Transaction(func(tx *sql.Tx) error {
+        err := insert[Game](tx, "games", game, gameValuesFormatter)
+        if err != nil {
+            return err
+        }
+        err = insert[Spec](tx, "specs", spec, specValuesFormatter)
+        if err != nil {
+            return err
+        }
+        for i := 0; i < len(players); i++ {
+            err = insert[Player](tx, "players", &players[i], playerValuesFormatter)
+            if err != nil {
+                return err
+            }
+        }
+        for i := 0; i < len(seats); i++ {
+            err = insert[Seat](tx, "seats", &seats[i], seatValuesFormatter)
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// Returns true if this call stored the result, and false if the game already
+//  had one
+func (ps *PostgresStore) InsertResult(result *Result) (bool, error) {
+    var inserted bool
+    err := dbconn.Transaction(func(tx *sql.Tx) error {
+        var err error
+        inserted, err = insertResult(tx, result)
+        if err != nil || !inserted {
+            return err
+        }
+        return notifyGame(tx, result.GameID)
+    })
+    return inserted && err == nil, err
 }
 
-func GetEmptySeats(gameID ID) ([]Seat, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM seats WHERE game_id = %d AND claimed = FALSE;", gameID)
-    return query[Seat](queryStr, seatScanner)
+// Returns true if this call stored the user, and false if the username was
+//  already taken
+func (ps *PostgresStore) InsertUser(user *User) (bool, error) {
+    values, err := userValuesFormatter(user)
+    if err != nil {
+        return false, err
+    }
+    command := fmt.Sprintf("INSERT INTO users VALUES (%s) ON CONFLICT (username) DO NOTHING;",
+                           placeholders(values))
+    res, err := dbconn.Exec(command, nonDefaults(values)...)
+    if err != nil {
+        return false, err
+    }
+    ra, err := res.RowsAffected()
+    return ra == 1 && err == nil, err
 }
 
-func GetAISeats(gameID ID) ([]Seat, error) {
-    queryStr := fmt.Sprintf("SELECT * FROM seats WHERE game_id = %d AND type = %d;", gameID, AI)
-    return query[Seat](queryStr, seatScanner)
+// A non-nil `result` is stored in the same transaction as the action. Returns
+//  ErrGameOver without storing anything if the game already has a result.
+func (ps *PostgresStore) InsertGameAction(action *GameAction, result *Result) error {
+    return dbconn.Transaction(func(tx *sql.Tx) error {
+        err := lockGame(tx, action.GameID)
+        if err != nil {
+            return err
+        }
+        over, err := hasResult(tx, action.GameID)
+        if err != nil {
+            return err
+        } else if over {
+            return ErrGameOver
+        }
+        err = insert[GameAction](tx, "game_actions", action, gameActionValuesFormatter)
+        if err != nil {
+            return err
+        }
+        if result != nil {
+            if _, err = insertResult(tx, result); err != nil {
+                return err
+            }
+        }
+        return notifyGame(tx, action.GameID)
+    })
 }
 
-func InsertGame(game *Game) error {
-    return insert[Game]("games", game, gameValuesFormatter)
+func (ps *PostgresStore) InsertChatMessage(message *ChatMessage) error {
+    return insert[ChatMessage](dbconn.Pool, "chat_messages", message, chatMessageValuesFormatter)
 }
 
-func InsertSpec(spec *Spec) error {
-    return insert[Spec]("specs", spec, specValuesFormatter)
+func (ps *PostgresStore) InsertSession(session *Session) error {
+    return insert[Session](dbconn.Pool, "sessions", session, sessionValuesFormatter)
 }
 
-func InsertPlayer(player *Player) error {
-    return insert[Player]("players", player, playerValuesFormatter)
+func (ps *PostgresStore) DeleteSession(tokenHash string) error {
+    _, err := dbconn.Exec("DELETE FROM sessions WHERE token_hash = $1;", tokenHash)
+    return err
 }
 
-func InsertSeat(seat *Seat) error {
-    return insert[Seat]("seats", seat, seatValuesFormatter)
+func (ps *PostgresStore) DeleteExpiredSessions() error {
+    _, err := dbconn.Exec("DELETE FROM sessions WHERE expires <= $1;", time.Now().Unix())
+    return err
 }
 
-func InsertMove(move *Move) error {
-    return insert[Move]("moves", move, moveValuesFormatter)
+// Returns a channel which receives a value after a change to the game is
+//  stored by any process, and a function which must be called once the channel
+//  is no longer read
+func (ps *PostgresStore) Subscribe(gameID ID) (<-chan struct{}, func()) {
+    return dbconn.Subscribe(gameChannel(gameID))
 }
 
 /////////////////////////// Non-Exported Functions ////////////////////////////
 
-func deleteFn(table string, key string, value ID) error {
-    command := fmt.Sprintf("DELETE FROM %s WHERE %s = %d;", table, key, value)
-    _, err := dbconn.Exec(command)
+// The notification channel for changes to a game
+func gameChannel(gameID ID) string {
+    return fmt.Sprintf("game_%d", gameID)
+}
+
+// Wakes subscribers to the game in every process once the current
+//  transaction commits. Postgres drops the notification if it rolls back.
+func notifyGame(ex dbconn.Executor, gameID ID) error {
+    _, err := ex.Exec("SELECT pg_notify($1, '');", gameChannel(gameID))
     return err
 }
 
-func insert[T any](table string, t *T, valuesFormatter func(x *T) (string, error)) error {
+// If the seat is a human seat matching `condition`, hands it the new player ID
+//  `newPlayerID`, applies `set` to it, and deletes its old player. `set` may
+//  use `args` as $3 onwards.
+func replaceSeatPlayer(gameID ID, seat int, newPlayerID ID, condition string, set string,
+                       args ...any) (bool, error) {
+    var replaced bool
+    err := dbconn.Transaction(func(tx *sql.Tx) error {
+        // `condition` and `set` always come from this package, never from users
+        var oldPlayerID ID
+        command := fmt.Sprintf(`SELECT player_id FROM seats
+                                WHERE game_id = $1 AND seat = $2 AND type = $3 AND %s
+                                FOR UPDATE;`, condition)
+        err := tx.QueryRow(command, gameID, seat, Human).Scan(&oldPlayerID)
+        if err == sql.ErrNoRows {
+            return nil
+        } else if err != nil {
+            return err
+        }
+        player := Player{ID: newPlayerID, GameID: gameID}
+        err = insert[Player](tx, "players", &player, playerValuesFormatter)
+        if err != nil {
+            return err
+        }
+        command = fmt.Sprintf("UPDATE seats SET player_id = $1, %s WHERE player_id = $2;", set)
+        _, err = tx.Exec(command, append([]any{newPlayerID, oldPlayerID}, args...)...)
+        if err != nil {
+            return err
+        }
+        err = deleteFn(tx, "players", "player_id", oldPlayerID)
+        if err != nil {
+            return err
+        }
+        replaced = true
+        return notifyGame(tx, gameID)
+    })
+    return replaced && err == nil, err
+}
+
+// Locks the game's row until the end of the transaction. Every write which
+//  must not race a game's result takes this lock first, as does storing the
+//  result itself.
+func lockGame(ex dbconn.Executor, gameID ID) error {
+    _, err := ex.Exec("SELECT game_id FROM games WHERE game_id = $1 FOR UPDATE;", gameID)
+    return err
+}
+
+func hasResult(ex dbconn.Executor, gameID ID) (bool, error) {
+    rows, err := ex.Query("SELECT 1 FROM results WHERE game_id = $1;", gameID)
+    if err != nil {
+        return false, err
+    }
+    defer rows.Close()
+    return rows.Next(), rows.Err()
+}
+
+// Returns true if this call stored the result, and false if the game already
+//  had one
+func insertResult(ex dbconn.Executor, result *Result) (bool, error) {
+    values, err := resultValuesFormatter(result)
+    if err != nil {
+        return false, err
+    }
+    if err = lockGame(ex, result.GameID); err != nil {
+        return false, err
+    }
+    command := fmt.Sprintf("INSERT INTO results VALUES (%s) ON CONFLICT (game_id) DO NOTHING;",
+                           placeholders(values))
+    res, err := ex.Exec(command, nonDefaults(values)...)
+    if err != nil {
+        return false, err
+    }
+    ra, err := res.RowsAffected()
+    return ra == 1 && err == nil, err
+}
+
+func deleteFn(ex dbconn.Executor, table string, key string, value ID) error {
+    // `table` and `key` always come from this package, never from users
+    command := fmt.Sprintf("DELETE FROM %s WHERE %s = $1;", table, key)
+    _, err := ex.Exec(command, value)
+    return err
+}
+
+// Marks a column which should take its default value on insertion
+type sqlDefault struct{}
+var defaultValue = sqlDefault{}
+
+// Formats `values` as a list of "DEFAULT" or $1, $2, ... placeholders
+func placeholders(values []any) string {
+    formatted := make([]string, len(values))
+    n := 0
+    for i, v := range values {
+        if _, isDefault := v.(sqlDefault); isDefault {
+            formatted[i] = "DEFAULT"
+        } else {
+            n++
+            formatted[i] = fmt.Sprintf("$%d", n)
+        }
+    }
+    return strings.Join(formatted, ", ")
+}
+
+// The values to bind to the placeholders produced by `placeholders(values)`
+func nonDefaults(values []any) []any {
+    args := make([]any, 0, len(values))
+    for _, v := range values {
+        if _, isDefault := v.(sqlDefault); !isDefault {
+            args = append(args, v)
+        }
+    }
+    return args
+}
+
+func insert[T any](ex dbconn.Executor, table string, t *T,
+                   valuesFormatter func(x *T) ([]any, error)) error {
     values, err := valuesFormatter(t)
     if err != nil {
         return err
     }
-    command := fmt.Sprintf("INSERT INTO %s VALUES (%s);", table, values)
-    _, err = dbconn.Exec(command)
+    // `table` always comes from this package, never from users
+    command := fmt.Sprintf("INSERT INTO %s VALUES (%s);", table, placeholders(values))
+    _, err = ex.Exec(command, nonDefaults(values)...)
     return err
 }
 
-func gameValuesFormatter(g *Game) (string, error) {
-    if len(g.Name) > dbschema.MaxStrLen {
-        return "", fmt.Errorf("Game name %s longer than max of %d characters",
+func gameValuesFormatter(g *Game) ([]any, error) {
+    if utf8.RuneCountInString(g.Name) > dbschema.MaxStrLen {
+        return nil, fmt.Errorf("Game name %s longer than max of %d characters",
                                 g.Name, dbschema.MaxStrLen)
     }
-    if len(g.Password) > dbschema.MaxStrLen {
-        return "", fmt.Errorf("Game password %s longer than max of %d characters",
+    if utf8.RuneCountInString(g.Password) > dbschema.MaxStrLen {
+        return nil, fmt.Errorf("Game password %s longer than max of %d characters",
                                 g.Password, dbschema.MaxStrLen)
     }
-    return fmt.Sprintf("%d, %d, %t, '%s', '%s', %d",
-                        g.ID, g.NumPlayers, g.Begun, g.Name,
-                        g.Password, time.Now().Unix()), nil
+    begunAt := g.BegunAt
+    if g.Begun && begunAt == 0 {
+        begunAt = Time(time.Now().Unix())
+    }
+    return []any{g.ID, g.NumPlayers, g.Begun, g.Name,
+                 g.Password, time.Now().Unix(), g.RematchID, begunAt, g.HostID,
+                 g.Locked}, nil
 }
-func specValuesFormatter(s *Spec) (string, error) {
+func specValuesFormatter(s *Spec) ([]any, error) {
     marshalled, err := json.Marshal(s.Spec)
-    return fmt.Sprintf("DEFAULT, %d, '%s'", s.GameID, string(marshalled)), err
+    return []any{defaultValue, s.GameID, string(marshalled)}, err
+}
+func playerValuesFormatter(p *Player) ([]any, error) {
+    return []any{p.ID, p.GameID, p.UserID}, nil
+}
+func spectatorValuesFormatter(s *Spectator) ([]any, error) {
+    return []any{s.ID, s.GameID, time.Now().Unix()}, nil
+}
+func seatValuesFormatter(s *Seat) ([]any, error) {
+    return []any{defaultValue, s.GameID, s.Seat, s.Type, s.Claimed, s.PlayerID, s.Difficulty, s.UserID, s.DisplayName,
+                 s.ReservedFor, s.ReservedUntil, s.LastSeen}, nil
+}
+func gameActionValuesFormatter(a *GameAction) ([]any, error) {
+    return []any{defaultValue, a.GameID, a.Seat, a.Action, a.Turn, time.Now().Unix()}, nil
+}
+func chatMessageValuesFormatter(m *ChatMessage) ([]any, error) {
+    return []any{defaultValue, m.GameID, m.Seat, m.Text, time.Now().Unix()}, nil
+}
+func userValuesFormatter(u *User) ([]any, error) {
+    return []any{u.ID, u.Username, u.PasswordHash, u.Salt, time.Now().Unix()}, nil
 }
-func playerValuesFormatter(p *Player) (string, error) {
-    return fmt.Sprintf("%d, %d", p.ID, p.GameID), nil
+func sessionValuesFormatter(s *Session) ([]any, error) {
+    return []any{s.TokenHash, s.UserID, s.Expires}, nil
 }
-func seatValuesFormatter(s *Seat) (string, error) {
-    return fmt.Sprintf("DEFAULT, %d, %d, %d, %t, %d", s.GameID, s.Seat, s.Type, s.Claimed, s.PlayerID), nil
+func moveValuesFormatter(m *Move) ([]any, error) {
+    timestamp := m.Timestamp
+    if timestamp == 0 {
+        timestamp = Time(time.Now().Unix())
+    }
+    return []any{defaultValue, m.GameID, m.Turn, m.X, m.Y, timestamp}, nil
 }
-func moveValuesFormatter(m *Move) (string, error) {
-    return fmt.Sprintf("DEFAULT, %d, %d, %d, %d", m.GameID, m.Turn, m.X, m.Y), nil
+func resultValuesFormatter(r *Result) ([]any, error) {
+    line := r.Line
+    if line == nil {
+        line = []Position{}
+    }
+    marshalled, err := json.Marshal(line)
+    return []any{r.GameID, r.Winner, string(marshalled), r.Turn, time.Now().Unix(), r.Reason}, err
 }
 
+func intScanner(r *sql.Rows, i *int) {
+    r.Scan(i)
+}
 func stringScanner(r *sql.Rows, s *string) {
     r.Scan(s)
 }
 func gameScanner(r *sql.Rows, g *Game) {
     r.Scan(&(g.ID), &(g.NumPlayers), &(g.Begun),
-           &(g.Name), &(g.Password), &(g.Timestamp))
+           &(g.Name), &(g.Password), &(g.Timestamp), &(g.RematchID), &(g.BegunAt),
+           &(g.HostID), &(g.Locked))
 }
 func specScanner(r *sql.Rows, s *Spec) {
     var stringifiedSpec StringifiedSpec
     r.Scan(&(stringifiedSpec.ID), &(stringifiedSpec.GameID), &(stringifiedSpec.SpecString))
     s.ID = stringifiedSpec.ID
-    s.GameID = stringifiedSpec.ID
+    s.GameID = stringifiedSpec.GameID
     json.NewDecoder(strings.NewReader(stringifiedSpec.SpecString)).Decode(&(s.Spec))
 }
 func playerScanner(r *sql.Rows, p *Player) {
-    r.Scan(&(p.ID), &(p.GameID)) 
+    r.Scan(&(p.ID), &(p.GameID), &(p.UserID))
+}
+func spectatorScanner(r *sql.Rows, s *Spectator) {
+    r.Scan(&(s.ID), &(s.GameID), &(s.Timestamp))
 }
 func seatScanner(r *sql.Rows, s *Seat) {
-    r.Scan(&(s.ID), &(s.GameID), &(s.Seat), &(s.Type), &(s.Claimed), &(s.PlayerID)) 
+    r.Scan(&(s.ID), &(s.GameID), &(s.Seat), &(s.Type), &(s.Claimed), &(s.PlayerID), &(s.Difficulty), &(s.UserID), &(s.DisplayName),
+           &(s.ReservedFor), &(s.ReservedUntil), &(s.LastSeen))
+}
+func gameActionScanner(r *sql.Rows, a *GameAction) {
+    r.Scan(&(a.ID), &(a.GameID), &(a.Seat), &(a.Action), &(a.Turn), &(a.Timestamp))
+}
+func chatMessageScanner(r *sql.Rows, m *ChatMessage) {
+    r.Scan(&(m.ID), &(m.GameID), &(m.Seat), &(m.Text), &(m.Timestamp))
+}
+func userScanner(r *sql.Rows, u *User) {
+    r.Scan(&(u.ID), &(u.Username), &(u.PasswordHash), &(u.Salt), &(u.Timestamp))
+}
+func sessionScanner(r *sql.Rows, s *Session) {
+    r.Scan(&(s.TokenHash), &(s.UserID), &(s.Expires))
 }
 func moveScanner(r *sql.Rows, m *Move) {
-    r.Scan(&(m.ID), &(m.GameID), &(m.Turn), &(m.X), &(m.Y)) 
+    r.Scan(&(m.ID), &(m.GameID), &(m.Turn), &(m.X), &(m.Y), &(m.Timestamp))
+}
+
+func resultScanner(r *sql.Rows, res *Result) {
+    var lineString string
+    r.Scan(&(res.GameID), &(res.Winner), &lineString, &(res.Turn), &(res.Timestamp), &(res.Reason))
+    json.NewDecoder(strings.NewReader(lineString)).Decode(&(res.Line))
 }
 
 func consumeRows[T any](rows *sql.Rows, scanner func(r *sql.Rows, t *T)) []T {
@@ -257,8 +728,8 @@ func consumeRows[T any](rows *sql.Rows, scanner func(r *sql.Rows, t *T)) []T {
     return result
 }
 
-func query[T any](queryStr string, scanner func(r *sql.Rows, t *T)) ([]T, error) {
-    rows, err := dbconn.Query(queryStr)
+func query[T any](queryStr string, scanner func(r *sql.Rows, t *T), args ...any) ([]T, error) {
+    rows, err := dbconn.Query(queryStr, args...)
     if err != nil {
         return nil, err
     }
@@ -281,14 +752,14 @@ func firstOfSlice[T any](s []T, err error, queryStr string, errIfMultiple bool)
 
 // Returns the single T, true if 1 or more results were found, and an error if
 //      the query was faulty or if the query returned multiple rows
-func singletonQuery[T any](queryStr string, scanner func(r *sql.Rows, t *T)) (T, bool, error) {
-    s, err := query[T](queryStr, scanner)
+func singletonQuery[T any](queryStr string, scanner func(r *sql.Rows, t *T), args ...any) (T, bool, error) {
+    s, err := query[T](queryStr, scanner, args...)
     return firstOfSlice[T](s, err, queryStr, true)
 }
 
 // Returns the single T, true if 1 or more results were found, and an error if
 //      the query was faulty
-func singletonQueryAllowMultiples[T any](queryStr string, scanner func(r *sql.Rows, t *T)) (T, bool, error) {
-    s, err := query[T](queryStr, scanner)
+func singletonQueryAllowMultiples[T any](queryStr string, scanner func(r *sql.Rows, t *T), args ...any) (T, bool, error) {
+    s, err := query[T](queryStr, scanner, args...)
     return firstOfSlice[T](s, err, queryStr, false)
 }
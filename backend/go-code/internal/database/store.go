@@ -0,0 +1,131 @@
+package database
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "linegames/backend/internal/dbconn"
+    "linegames/backend/internal/dbschema"
+)
+
+// Returned by writes which are only allowed before the game has a result
+var ErrGameOver = errors.New("Game is already over")
+
+// Everything the servers need from the database.
+//
+// PostgresStore is the real implementation; memstore.MemoryStore keeps
+//  everything in memory so that handlers can be tested without a database.
+type Store interface {
+    ValidLogin(gameID ID, password string) (bool, error)
+    GetNonBegunGames() ([]Game, error)
+    // Also records when the game began, unless it had already begun
+    SetBegun(gameID ID) error
+    // Returns true if this call caused `claimed` to be set to true. `userID`
+    //  is recorded on the seat and its player, and is 0 for anonymous players.
+    ClaimSeat(gameID ID, seat int, userID ID, displayName string) (bool, error)
+    RefreshGameTimestamp(gameID ID) error
+    SetLocked(gameID ID, locked bool) error
+    // Makes `hostID` the game's host, or leaves the game without one if it is
+    //  0
+    SetHost(gameID ID, hostID ID) error
+    // Records a heartbeat from the seat held by `playerID`
+    TouchSeat(playerID ID) error
+    // The inverse of ClaimSeat: empties a claimed human seat and hands it the
+    //  new player ID `newPlayerID`, so that the previous occupant's ID stops
+    //  working. Returns true if this call emptied the seat.
+    ReopenSeat(gameID ID, seat int, newPlayerID ID) (bool, error)
+    // Turns a human seat into an AI seat held by the new player ID
+    //  `newPlayerID`, as long as whether it is claimed still matches
+    //  `claimed`. Returns true if this call converted the seat.
+    ConvertSeatToAI(gameID ID, seat int, claimed bool, newPlayerID ID, difficulty Difficulty) (bool, error)
+    // Records `rematchID` as the game's rematch unless it already has one, and
+    //  returns whichever rematch ID is recorded
+    SetRematch(gameID ID, rematchID ID) (ID, error)
+    // Deletes every row belonging to the game, or nothing if any deletion fails
+    DeleteAllGameData(gameID ID) error
+
+    // Get games that have existed for duration `d` or longer
+    GetOldGames(d Duration, begun bool) ([]Game, error)
+    // Get finished games whose result was recorded duration `d` or longer ago
+    GetOldFinishedGames(d Duration) ([]Game, error)
+    // Get begun, unfinished games in which the seat due to play the next turn
+    //  is an AI
+    GetGamesAwaitingAI() ([]Game, error)
+
+    GetGame(gameID ID) (Game, bool, error)
+    GetSpec(gameID ID) (Spec, bool, error)
+    GetPlayer(playerID ID) (Player, bool, error)
+    GetPlayers(gameID ID) ([]Player, error)
+    GetSpectator(spectatorID ID) (Spectator, bool, error)
+    GetPlayerSeat(playerID ID) (Seat, bool, error)
+    GetSeat(gameID ID, seat int) (Seat, bool, error)
+    // Returns every seat of the game sorted by seat index
+    GetSeats(gameID ID) ([]Seat, error)
+    GetEmptySeats(gameID ID) ([]Seat, error)
+    GetAISeats(gameID ID) ([]Seat, error)
+    GetMove(gameID ID, turn int) (Move, bool, error)
+    // Returns every move of the game sorted by turn
+    GetAllMoves(gameID ID) ([]Move, error)
+    // Returns at most `limit` moves (any number if `limit` <= 0) sorted by
+    //  turn, starting from `fromTurn`
+    GetMoves(gameID ID, fromTurn int, limit int) ([]Move, error)
+    GetResult(gameID ID) (Result, bool, error)
+    // Returns the game's actions sorted by ID, starting after ID `afterID`
+    GetGameActions(gameID ID, afterID uint) ([]GameAction, error)
+    // Returns at most `limit` messages sorted by ID, starting after ID
+    //  `afterID`
+    GetChatMessages(gameID ID, afterID uint, limit int) ([]ChatMessage, error)
+    // Counts the messages sent from the seat within the last duration `d`
+    CountRecentChatMessages(gameID ID, seat int, d Duration) (int, error)
+    GetUser(userID ID) (User, bool, error)
+    GetUserByName(username string) (User, bool, error)
+    // Only finds sessions which have not expired
+    GetSession(tokenHash string) (Session, bool, error)
+
+    InsertGame(game *Game) error
+    InsertSpec(spec *Spec) error
+    InsertPlayer(player *Player) error
+    InsertSpectator(spectator *Spectator) error
+    InsertSeat(seat *Seat) error
+    // Returns true if this call stored the move, and false if a move for the
+    //  same turn of the game was already stored. Otherwise returns ErrGameOver
+    //  without storing anything if the game already has a result, checked
+    //  along with the insertion so that no move can follow a result.
+    //
+    // A zero `Timestamp` is stored as the current time. A non-nil `result` is
+    //  stored along with the move, so that the move which ends a game is never
+    //  stored without the game's result.
+    InsertMoveIfAbsent(move *Move, result *Result) (bool, error)
+    // Returns true if this call stored the result, and false if the game
+    //  already had one
+    InsertResult(result *Result) (bool, error)
+    // A non-nil `result` is stored along with the action. Returns ErrGameOver
+    //  without storing anything if the game already has a result.
+    InsertGameAction(action *GameAction, result *Result) error
+    InsertChatMessage(message *ChatMessage) error
+    // Returns true if this call stored the user, and false if the username was
+    //  already taken
+    InsertUser(user *User) (bool, error)
+    InsertSession(session *Session) error
+    DeleteSession(tokenHash string) error
+    DeleteExpiredSessions() error
+    // Inserts all of a new game's rows, or none of them if any insertion fails
+    CreateGame(game *Game, spec *Spec, players []Player, seats []Seat) error
+
+    // Returns a channel which receives a value after a move, seat change, game
+    //  action, or result is stored for the game (by any process), and a
+    //  function which must be called once the channel is no longer read.
+    //
+    // Several changes may be coalesced into one value, so subscribers re-read
+    //  whatever they are interested in.
+    Subscribe(gameID ID) (<-chan struct{}, func())
+}
+
+type PostgresStore struct{}
+
+// Blocks until connected to the database, then brings the schema up to date
+func NewPostgresStore() *PostgresStore {
+    dbconn.Connect()
+    dbschema.EnsureUpToDate()
+    return new(PostgresStore)
+}
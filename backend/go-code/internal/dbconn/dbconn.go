@@ -1,6 +1,7 @@
 package dbconn
 
 import (
+    "context"
     "database/sql"
     "fmt"
     _ "github.com/lib/pq"
@@ -22,26 +23,89 @@ var db *sql.DB
 var disconnected bool = true
 var connectAttempts int = 0
 var connectionLock sync.Mutex
+var connectOnce sync.Once
 
 // runs the normal sql.Exec, except that this function makes one
 //  or two attempts to reconnect to the database if the connection is broken
-func Exec(query string) (sql.Result, error) {
-    return perform[sql.Result](execDB, query)
+//
+// `args` are bound to the query's $1, $2, ... placeholders
+func Exec(query string, args ...any) (sql.Result, error) {
+    return perform[sql.Result](execDB, query, args)
 }
 
 // runs the normal sql.Query, except that this function makes one
 //  or two attempts to reconnect to the database if the connection is broken
-func Query(query string) (*sql.Rows, error) {
-    return perform[*sql.Rows](queryDB, query)
+//
+// `args` are bound to the query's $1, $2, ... placeholders
+func Query(query string, args ...any) (*sql.Rows, error) {
+    return perform[*sql.Rows](queryDB, query, args)
 }
 
-// Connect to the database and create the required tables if they are not
-//  present
-func init() {
-    // Do nothing until we are connected
-    //
-    // Since intialization is serial, we do not need to worry about
-    //  concurrency here
+// Runs statements either in a transaction (*sql.Tx) or directly on the
+//  database (Pool)
+type Executor interface {
+    Exec(query string, args ...any) (sql.Result, error)
+    Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type pool struct{}
+func (p pool) Exec(query string, args ...any) (sql.Result, error) {
+    return Exec(query, args...)
+}
+func (p pool) Query(query string, args ...any) (*sql.Rows, error) {
+    return Query(query, args...)
+}
+
+// Runs each statement on its own, outside of any transaction, using the
+//  reconnecting Exec and Query
+var Pool Executor = pool{}
+
+// runs the normal sql.Begin, except that this function makes one
+//  or two attempts to reconnect to the database if the connection is broken
+//
+// The caller must finish the transaction with Commit or Rollback.
+func Begin() (*sql.Tx, error) {
+    return perform[*sql.Tx](beginDB, "", nil)
+}
+
+// Runs `fn` in a transaction which is committed if `fn` succeeds and rolled
+//  back if it returns an error
+func Transaction(fn func(tx *sql.Tx) error) error {
+    tx, err := Begin()
+    if err != nil {
+        return err
+    }
+    err = fn(tx)
+    if err != nil {
+        rollbackErr := tx.Rollback()
+        if rollbackErr != nil {
+            log.Printf("Rollback failed: %s\n", rollbackErr.Error())
+        }
+        return err
+    }
+    return tx.Commit()
+}
+
+// Runs `fn` on a single connection, so that session state such as advisory
+//  locks carries over between statements
+func Session(fn func(conn *sql.Conn) error) error {
+    conn, err := perform[*sql.Conn](connDB, "", nil)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    return fn(conn)
+}
+
+// Blocks until connected to the database.
+//
+// Programs call this once at startup; after that, Exec, Query, etc. reconnect
+//  on their own if the connection breaks.
+func Connect() {
+    connectOnce.Do(waitForConnection)
+}
+
+func waitForConnection() {
     connected := checkIfConnected()
     for !connected {
         attemptToConnect()
@@ -88,19 +152,10 @@ func attemptToConnect() (*sql.DB, error) {
         db = nil
     }
 
-    host := os.Getenv("DATABASE_HOST")
-    password_file := os.Getenv("POSTGRES_PASSWORD_FILE")
-
-    var password []byte
-    password, err = os.ReadFile(password_file)
+    psqlconn, err := connectionString()
     if err != nil {
         return nil, err
     }
-    passwordString := string(password)
-
-    // connection string
-    psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-                            host, port, user, passwordString, dbName)
 
     var attempt *sql.DB
     attempt, err = sql.Open(dbType, psqlconn)
@@ -114,18 +169,41 @@ func attemptToConnect() (*sql.DB, error) {
     return db, nil
 }
 
-func execDB(db *sql.DB, q string) (sql.Result, error) {
-    return db.Exec(q)
+// Reads the password file each time so that rotated passwords are picked up
+func connectionString() (string, error) {
+    host := os.Getenv("DATABASE_HOST")
+    password_file := os.Getenv("POSTGRES_PASSWORD_FILE")
+
+    password, err := os.ReadFile(password_file)
+    if err != nil {
+        return "", err
+    }
+    passwordString := string(password)
+
+    return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+                       host, port, user, passwordString, dbName), nil
+}
+
+func execDB(db *sql.DB, q string, args []any) (sql.Result, error) {
+    return db.Exec(q, args...)
+}
+
+func queryDB(db *sql.DB, q string, args []any) (*sql.Rows, error) {
+    return db.Query(q, args...)
+}
+
+func beginDB(db *sql.DB, _ string, _ []any) (*sql.Tx, error) {
+    return db.Begin()
 }
 
-func queryDB(db *sql.DB, q string) (*sql.Rows, error) {
-    return db.Query(q)
+func connDB(db *sql.DB, _ string, _ []any) (*sql.Conn, error) {
+    return db.Conn(context.Background())
 }
 
 // like the normal sql.Exec or sql.Query, except that this function makes one
 //  or two attempts to reconnect to the database if the connection is broken
-func perform[T any](op func(db *sql.DB, q string) (T, error),
-             query string) (T, error) {
+func perform[T any](op func(db *sql.DB, q string, args []any) (T, error),
+             query string, args []any) (T, error) {
 
     var err error
     var result T
@@ -139,7 +217,7 @@ func perform[T any](op func(db *sql.DB, q string) (T, error),
         }
     }
 
-    result, err = op(tempDB, query)
+    result, err = op(tempDB, query, args)
     if err == nil {
         return result, nil
     }
@@ -151,5 +229,5 @@ func perform[T any](op func(db *sql.DB, q string) (T, error),
     if err != nil {
         return result, err
     }
-    return op(tempDB, query)
+    return op(tempDB, query, args)
 }
@@ -0,0 +1,200 @@
+package dbconn
+
+// Fans Postgres notifications (NOTIFY / pg_notify) out to subscribers in this
+//  process
+//
+// One connection LISTENs on every channel which has at least one subscriber.
+//  If that connection breaks, it is re-established the same way as the main
+//  connection, and every subscriber is woken, since notifications sent in the
+//  meantime were lost.
+
+import (
+    "github.com/lib/pq"
+    "log"
+    "sync"
+    "time"
+)
+
+const (
+    // How often the listening connection is checked for silent breakage
+    listenerPingPeriod = 30 * time.Second
+)
+
+var listenerConn *pq.ListenerConn
+var listenerConnLock sync.Mutex   // Held while using listenerConn
+var listenerAttempts int = 0
+var listenerOnce sync.Once
+
+var subscribers = make(map[string]map[chan struct{}]bool)
+var subscribersLock sync.Mutex    // Never held while waiting on the database
+
+// Returns a channel which receives a value after each notification on
+//  `channel`, and a function which must be called once the channel is no
+//  longer read.
+//
+// Notifications which arrive while a value is still waiting to be read are
+//  coalesced, so subscribers should treat a value as "something changed".
+func Subscribe(channel string) (<-chan struct{}, func()) {
+    listenerOnce.Do(func() { go listen() })
+
+    listenerConnLock.Lock()
+    defer listenerConnLock.Unlock()
+
+    wake := make(chan struct{}, 1)
+    subscribersLock.Lock()
+    first := len(subscribers[channel]) == 0
+    if first {
+        subscribers[channel] = make(map[chan struct{}]bool)
+    }
+    subscribers[channel][wake] = true
+    subscribersLock.Unlock()
+
+    if first && listenerConn != nil {
+        _, err := listenerConn.Listen(channel)
+        if err != nil {
+            // listen() will reconnect and LISTEN on every channel again
+            log.Printf("LISTEN %s failed: %s\n", channel, err.Error())
+            listenerConn.Close()
+        }
+    }
+
+    cancel := func() {
+        listenerConnLock.Lock()
+        defer listenerConnLock.Unlock()
+        subscribersLock.Lock()
+        delete(subscribers[channel], wake)
+        last := len(subscribers[channel]) == 0
+        if last {
+            delete(subscribers, channel)
+        }
+        subscribersLock.Unlock()
+
+        if last && listenerConn != nil {
+            listenerConn.Unlisten(channel)
+        }
+    }
+    return wake, cancel
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Runs forever, dispatching notifications and reconnecting when needed
+func listen() {
+    for {
+        notifications := connectListener()
+        // Anything could have happened while disconnected
+        wakeAll()
+
+        done := make(chan struct{})
+        go pingListener(done)
+        for n := range notifications {
+            wake(n.Channel)
+        }
+        close(done)
+        log.Printf("Lost the notification listener connection\n")
+
+        listenerConnLock.Lock()
+        listenerConn.Close()
+        listenerConn = nil
+        listenerConnLock.Unlock()
+    }
+}
+
+// Blocks until connected and listening on every subscribed channel
+func connectListener() <-chan *pq.Notification {
+    for {
+        listenerConnLock.Lock()
+        notifications, err := attemptToConnectListener()
+        listenerConnLock.Unlock()
+        if err == nil {
+            return notifications
+        }
+        log.Printf("Listener connection attempt failed:\n")
+        log.Printf(err.Error() + "\n")
+        time.Sleep(time.Second)
+    }
+}
+
+// Assumes listenerConnLock is held
+func attemptToConnectListener() (<-chan *pq.Notification, error) {
+    listenerAttempts += 1
+    log.Printf("Listener (re)connection attempt #%d\n", listenerAttempts)
+
+    psqlconn, err := connectionString()
+    if err != nil {
+        return nil, err
+    }
+    notifications := make(chan *pq.Notification, 32)
+    conn, err := pq.NewListenerConn(psqlconn, notifications)
+    if err != nil {
+        return nil, err
+    }
+
+    subscribersLock.Lock()
+    channels := make([]string, 0, len(subscribers))
+    for channel := range subscribers {
+        channels = append(channels, channel)
+    }
+    subscribersLock.Unlock()
+    for _, channel := range channels {
+        _, err = conn.Listen(channel)
+        if err != nil {
+            conn.Close()
+            return nil, err
+        }
+    }
+
+    listenerConn = conn
+    log.Printf("Listener attempt succeeded. Resetting listener attempts counter.\n")
+    listenerAttempts = 0
+    return notifications, nil
+}
+
+// A broken connection is only noticed when something is sent over it, so
+//  send something regularly until `done` is closed
+func pingListener(done chan struct{}) {
+    ticker := time.NewTicker(listenerPingPeriod)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-done:
+            return
+        case <-ticker.C:
+        }
+        listenerConnLock.Lock()
+        if listenerConn == nil {
+            listenerConnLock.Unlock()
+            return
+        }
+        err := listenerConn.Ping()
+        if err != nil {
+            // Closes the notifications channel, so listen() reconnects
+            listenerConn.Close()
+        }
+        listenerConnLock.Unlock()
+    }
+}
+
+func wake(channel string) {
+    subscribersLock.Lock()
+    defer subscribersLock.Unlock()
+    for w := range subscribers[channel] {
+        select {
+        case w <- struct{}{}:
+        default:
+            // A wakeup is already pending
+        }
+    }
+}
+
+func wakeAll() {
+    subscribersLock.Lock()
+    channels := make([]string, 0, len(subscribers))
+    for channel := range subscribers {
+        channels = append(channels, channel)
+    }
+    subscribersLock.Unlock()
+    for _, channel := range channels {
+        wake(channel)
+    }
+}
@@ -1,65 +1,275 @@
 package dbschema
 
+// Versioned schema migrations
+//
+// Each migration is a pair of files in migrations/ named
+//  <version>_<name>.up.sql and <version>_<name>.down.sql, which are embedded
+//  in every binary importing this package. The versions which have been
+//  applied are recorded in the `schema_migrations` table.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
 import (
+    "context"
+    "database/sql"
+    "embed"
+    "fmt"
     "linegames/backend/internal/dbconn"
     "log"
+    "path"
+    "regexp"
+    "sort"
+    "strconv"
     "time"
 )
 
-// Table schemas
 const (
     MaxStrLen = 15  // Max length of varchars
-    // The value of `created` is supposed to be unix time in seconds
-    games = "( game_id INT8 PRIMARY KEY, num_players INT, begun BOOL, name VARCHAR(15), pwd VARCHAR(15), timestamp INT8 )"
-    specs = "( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, spec JSON )"
-    players = "( player_id INT8 PRIMARY KEY, game_id INT8 REFERENCES games )"
-    seats = "( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, seat INT, type INT, claimed BOOL, player_id INT8 REFERENCES players )"
-    moves = "( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, turn INT, x INT, y INT )"
+
+    // Held while migrating so that only one pod changes the schema at a time
+    lockID = 1234
+
+    migrationsTable = "( version INT PRIMARY KEY, name VARCHAR(255), applied_at INT8 )"
 )
 
-// Create the necessary tables if they are not already present
-func init() {
-    log.Printf("Ensuring necessary tables are present in database...\n")
-
-    schemas :=    [5]string{ games,   specs,   players,   seats,   moves }
-    tableNames := [5]string{"games", "specs", "players", "seats", "moves"}
-    var success bool
-    for i := 0; i < len(schemas); i++ {
-        success = false
-        for !success {
-            _, lockErr := dbconn.Exec("SELECT pg_advisory_lock(1234);")
-            if lockErr != nil {
-                log.Printf("Locking attempt error:\n")
-                log.Printf(lockErr.Error() + "\n")
-                log.Printf("Trying again...\n")
-                time.Sleep(1 * time.Second)
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+    Version int
+    Name string
+    Up string    // SQL which applies the migration
+    Down string  // SQL which reverts the migration
+}
+
+type MigrationStatus struct {
+    Migration
+    Applied bool
+    AppliedAt Time
+}
+
+// Returns every embedded migration sorted by version
+func Migrations() ([]Migration, error) {
+    entries, err := migrationFiles.ReadDir("migrations")
+    if err != nil {
+        return nil, err
+    }
+
+    byVersion := make(map[int]*Migration)
+    for _, entry := range entries {
+        match := migrationFileName.FindStringSubmatch(entry.Name())
+        if match == nil {
+            return nil, fmt.Errorf("Badly named migration file %s", entry.Name())
+        }
+        version, _ := strconv.Atoi(match[1])
+        contents, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+        if err != nil {
+            return nil, err
+        }
+
+        m, present := byVersion[version]
+        if !present {
+            m = &Migration{Version: version, Name: match[2]}
+            byVersion[version] = m
+        } else if m.Name != match[2] {
+            return nil, fmt.Errorf("Migration version %d has two names: %s and %s",
+                                   version, m.Name, match[2])
+        }
+        if match[3] == "up" {
+            m.Up = string(contents)
+        } else {
+            m.Down = string(contents)
+        }
+    }
+
+    result := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.Up == "" || m.Down == "" {
+            return nil, fmt.Errorf("Migration %d_%s needs both an up and a down file",
+                                   m.Version, m.Name)
+        }
+        result = append(result, *m)
+    }
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].Version < result[j].Version
+    })
+    return result, nil
+}
+
+// Applies every migration which has not been applied yet, in order.
+//
+// Returns the migrations applied by this call.
+func Up() ([]Migration, error) {
+    all, err := Migrations()
+    if err != nil {
+        return nil, err
+    }
+    done := make([]Migration, 0)
+    err = withLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedVersions(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for _, m := range all {
+            if _, present := applied[m.Version]; present {
                 continue
             }
+            err = run(ctx, conn, m, true)
+            if err != nil {
+                return err
+            }
+            done = append(done, m)
+        }
+        return nil
+    })
+    return done, err
+}
 
-            _, err := dbconn.Exec("CREATE TABLE IF NOT EXISTS " + tableNames[i] + " " + schemas[i] + ";")
+// Reverts the `steps` most recently applied migrations, newest first.
+//
+// Returns the migrations reverted by this call.
+func Down(steps int) ([]Migration, error) {
+    all, err := Migrations()
+    if err != nil {
+        return nil, err
+    }
+    done := make([]Migration, 0)
+    err = withLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedVersions(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for i := len(all) - 1; i >= 0 && len(done) < steps; i-- {
+            if _, present := applied[all[i].Version]; !present {
+                continue
+            }
+            err = run(ctx, conn, all[i], false)
+            if err != nil {
+                return err
+            }
+            done = append(done, all[i])
+        }
+        return nil
+    })
+    return done, err
+}
 
+// Reports which migrations have been applied
+func Status() ([]MigrationStatus, error) {
+    all, err := Migrations()
+    if err != nil {
+        return nil, err
+    }
+    result := make([]MigrationStatus, len(all))
+    err = withLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedVersions(ctx, conn)
+        if err != nil {
+            return err
+        }
+        for i, m := range all {
+            result[i].Migration = m
+            result[i].AppliedAt, result[i].Applied = applied[m.Version]
+        }
+        return nil
+    })
+    return result, err
+}
+
+// Applies any pending migrations, retrying until it succeeds
+func EnsureUpToDate() {
+    log.Printf("Ensuring database schema is up to date...\n")
+    for {
+        done, err := Up()
+        for _, m := range done {
+            log.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+        }
+        if err == nil {
+            break
+        }
+        log.Printf("Migration attempt failed:\n")
+        log.Printf(err.Error() + "\n")
+        log.Printf("Trying again...\n")
+        time.Sleep(1 * time.Second)
+    }
+    log.Printf("...database schema is ready.\n")
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Runs `fn` on a single connection holding the migration lock, after making
+//  sure the `schema_migrations` table exists
+func withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+    return dbconn.Session(func(conn *sql.Conn) error {
+        ctx := context.Background()
+        _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", lockID)
+        if err != nil {
+            return err
+        }
+        defer func() {
             for {
                 // Unlocking is more important than locking -- keep trying
-                _, lockErr = dbconn.Exec("SELECT pg_advisory_unlock(1234);")
-                if lockErr != nil {
-                    log.Printf("Unlocking attempt error:\n")
-                    log.Printf(lockErr.Error() + "\n")
-                    log.Printf("Trying again...\n")
-                    time.Sleep(1 * time.Second)
-                } else {
+                _, lockErr := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", lockID)
+                if lockErr == nil {
                     break
                 }
-            }
-
-            if err != nil {
-                log.Printf("Attempt failed for table " + tableNames[i] + ":\n")
-                log.Printf(err.Error() + "\n")
+                log.Printf("Unlocking attempt error:\n")
+                log.Printf(lockErr.Error() + "\n")
                 log.Printf("Trying again...\n")
                 time.Sleep(1 * time.Second)
-            } else {
-                success = true
             }
+        }()
+
+        _, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations " + migrationsTable + ";")
+        if err != nil {
+            return err
+        }
+        return fn(ctx, conn)
+    })
+}
+
+// Maps the version of each applied migration to when it was applied
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]Time, error) {
+    rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations;")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    applied := make(map[int]Time)
+    for rows.Next() {
+        var version int
+        var appliedAt Time
+        err = rows.Scan(&version, &appliedAt)
+        if err != nil {
+            return nil, err
+        }
+        applied[version] = appliedAt
+    }
+    return applied, rows.Err()
+}
+
+// Applies (`up`) or reverts (!`up`) `m` and records it, all in one transaction
+func run(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    if up {
+        _, err = tx.ExecContext(ctx, m.Up)
+        if err == nil {
+            _, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations VALUES ($1, $2, $3);",
+                                    m.Version, m.Name, time.Now().Unix())
         }
+    } else {
+        _, err = tx.ExecContext(ctx, m.Down)
+        if err == nil {
+            _, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1;", m.Version)
+        }
+    }
+    if err != nil {
+        tx.Rollback()
+        return fmt.Errorf("Migration %04d_%s failed: %v", m.Version, m.Name, err)
     }
-    log.Printf("...database tables are ready.\n")
+    return tx.Commit()
 }
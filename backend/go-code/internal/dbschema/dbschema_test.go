@@ -0,0 +1,46 @@
+package dbschema
+
+import (
+    "fmt"
+    "strconv"
+    "testing"
+)
+
+// Migrations are applied in version order, so a gap or a repeated version
+//  (two branches each adding the next migration) would skip or reorder one
+func TestMigrationVersions(t *testing.T) {
+    migrations, err := Migrations()
+    if err != nil {
+        t.Fatalf("Could not read the migrations: %v", err)
+    }
+    if len(migrations) == 0 {
+        t.Fatalf("No migrations embedded")
+    }
+    for i, m := range migrations {
+        if m.Version != i + 1 {
+            t.Errorf("Expected migration %d to have version %d, got %d_%s", i, i + 1, m.Version, m.Name)
+        }
+    }
+
+    // Every file name carries the four-digit version, so that a listing sorts
+    //  in the order the migrations are applied
+    entries, err := migrationFiles.ReadDir("migrations")
+    if err != nil {
+        t.Fatalf("Could not list the migrations: %v", err)
+    }
+    if len(entries) != 2 * len(migrations) {
+        t.Errorf("Expected an up and a down file for each of %d migrations, got %d files",
+                 len(migrations), len(entries))
+    }
+    for _, entry := range entries {
+        match := migrationFileName.FindStringSubmatch(entry.Name())
+        if match == nil {
+            t.Errorf("Badly named migration file %s", entry.Name())
+            continue
+        }
+        version, _ := strconv.Atoi(match[1])
+        if match[1] != fmt.Sprintf("%04d", version) {
+            t.Errorf("Expected a four-digit version in %s", entry.Name())
+        }
+    }
+}
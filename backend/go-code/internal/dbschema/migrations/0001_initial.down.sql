@@ -0,0 +1,5 @@
+DROP TABLE moves;
+DROP TABLE seats;
+DROP TABLE players;
+DROP TABLE specs;
+DROP TABLE games;
@@ -0,0 +1,9 @@
+-- The tables which existed before versioned migrations. They are created only
+--  if missing so that databases set up by the old schema code keep their data.
+
+-- The value of `timestamp` is unix time in seconds
+CREATE TABLE IF NOT EXISTS games ( game_id INT8 PRIMARY KEY, num_players INT, begun BOOL, name VARCHAR(15), pwd VARCHAR(15), timestamp INT8 );
+CREATE TABLE IF NOT EXISTS specs ( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, spec JSON );
+CREATE TABLE IF NOT EXISTS players ( player_id INT8 PRIMARY KEY, game_id INT8 REFERENCES games );
+CREATE TABLE IF NOT EXISTS seats ( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, seat INT, type INT, claimed BOOL, player_id INT8 REFERENCES players );
+CREATE TABLE IF NOT EXISTS moves ( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, turn INT, x INT, y INT );
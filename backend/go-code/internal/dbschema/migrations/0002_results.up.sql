@@ -0,0 +1,2 @@
+-- `winner` is -1 for a draw and `line` is a JSON array of positions
+CREATE TABLE IF NOT EXISTS results ( game_id INT8 PRIMARY KEY REFERENCES games, winner INT, line JSON, turn INT, timestamp INT8 );
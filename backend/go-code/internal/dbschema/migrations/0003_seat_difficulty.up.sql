@@ -0,0 +1 @@
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS difficulty INT DEFAULT 1;
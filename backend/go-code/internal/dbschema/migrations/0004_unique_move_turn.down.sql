@@ -0,0 +1 @@
+ALTER TABLE moves DROP CONSTRAINT moves_game_id_turn_key;
@@ -0,0 +1,4 @@
+-- Only one move may be stored per turn. Where a turn was stored more than
+--  once, keep the first insertion, which is the one replays have always used.
+DELETE FROM moves a USING moves b WHERE a.game_id = b.game_id AND a.turn = b.turn AND a.id > b.id;
+ALTER TABLE moves ADD CONSTRAINT moves_game_id_turn_key UNIQUE (game_id, turn);
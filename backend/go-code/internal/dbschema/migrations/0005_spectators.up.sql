@@ -0,0 +1,2 @@
+-- Read-only IDs for watching a game. `timestamp` is unix time in seconds.
+CREATE TABLE IF NOT EXISTS spectators ( spectator_id INT8 PRIMARY KEY, game_id INT8 REFERENCES games, timestamp INT8 );
@@ -0,0 +1,4 @@
+ALTER TABLE seats DROP COLUMN user_id;
+ALTER TABLE players DROP COLUMN user_id;
+DROP TABLE sessions;
+DROP TABLE users;
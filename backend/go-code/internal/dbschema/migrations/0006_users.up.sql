@@ -0,0 +1,8 @@
+-- `timestamp` and `expires` are unix time in seconds. Sessions are keyed by a
+--  hash of their token, never by the token itself.
+CREATE TABLE IF NOT EXISTS users ( user_id INT8 PRIMARY KEY, username VARCHAR(15) UNIQUE, password_hash VARCHAR(64), salt VARCHAR(32), timestamp INT8 );
+CREATE TABLE IF NOT EXISTS sessions ( token_hash VARCHAR(64) PRIMARY KEY, user_id INT8 REFERENCES users, expires INT8 );
+
+-- A `user_id` of 0 means that no signed-in user holds the player ID or seat
+ALTER TABLE players ADD COLUMN IF NOT EXISTS user_id INT8 DEFAULT 0;
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS user_id INT8 DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE seats DROP COLUMN display_name;
@@ -0,0 +1 @@
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS display_name VARCHAR(20) DEFAULT '';
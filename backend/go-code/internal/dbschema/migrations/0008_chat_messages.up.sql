@@ -0,0 +1,3 @@
+-- `timestamp` is unix time in seconds. Messages are ordered by `id`.
+CREATE TABLE IF NOT EXISTS chat_messages ( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, seat INT, text VARCHAR(200), timestamp INT8 );
+CREATE INDEX IF NOT EXISTS chat_messages_game_id_idx ON chat_messages (game_id, id);
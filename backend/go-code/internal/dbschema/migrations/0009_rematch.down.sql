@@ -0,0 +1,3 @@
+ALTER TABLE seats DROP COLUMN reserved_until;
+ALTER TABLE seats DROP COLUMN reserved_for;
+ALTER TABLE games DROP COLUMN rematch_id;
@@ -0,0 +1,6 @@
+-- A `rematch_id` of 0 means that no rematch has been created. A seat with a
+--  `reserved_until` in the future (unix time in seconds) is held for the
+--  player ID `reserved_for` from the previous game.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS rematch_id INT8 DEFAULT 0;
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS reserved_for INT8 DEFAULT 0;
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS reserved_until INT8 DEFAULT 0;
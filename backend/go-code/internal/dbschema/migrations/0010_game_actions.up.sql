@@ -0,0 +1,6 @@
+-- Resignations and draw offers. `turn` is the turn which was next when the
+--  action was taken, and `timestamp` is unix time in seconds.
+CREATE TABLE IF NOT EXISTS game_actions ( id SERIAL PRIMARY KEY, game_id INT8 REFERENCES games, seat INT, action INT, turn INT, timestamp INT8 );
+
+-- How the game ended; 0 means it was played to a win or a full board
+ALTER TABLE results ADD COLUMN IF NOT EXISTS reason INT DEFAULT 0;
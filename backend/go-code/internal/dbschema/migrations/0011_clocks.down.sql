@@ -0,0 +1,2 @@
+ALTER TABLE moves DROP COLUMN timestamp;
+ALTER TABLE games DROP COLUMN begun_at;
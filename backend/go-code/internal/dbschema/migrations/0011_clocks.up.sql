@@ -0,0 +1,3 @@
+-- Unix times in seconds, from which each seat's clock is computed
+ALTER TABLE games ADD COLUMN IF NOT EXISTS begun_at INT8 DEFAULT 0;
+ALTER TABLE moves ADD COLUMN IF NOT EXISTS timestamp INT8 DEFAULT 0;
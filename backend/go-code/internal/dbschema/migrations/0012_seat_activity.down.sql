@@ -0,0 +1,2 @@
+ALTER TABLE games DROP COLUMN host_id;
+ALTER TABLE seats DROP COLUMN last_seen;
@@ -0,0 +1,4 @@
+-- `last_seen` is the unix time in seconds of the seat's latest heartbeat, or 0
+--  if it has never sent one. A `host_id` of 0 means that the game has no host.
+ALTER TABLE seats ADD COLUMN IF NOT EXISTS last_seen INT8 DEFAULT 0;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS host_id INT8 DEFAULT 0;
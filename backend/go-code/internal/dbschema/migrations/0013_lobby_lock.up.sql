@@ -0,0 +1,2 @@
+-- Nobody may join a locked game, and it is left out of the lobby list
+ALTER TABLE games ADD COLUMN IF NOT EXISTS locked BOOL DEFAULT FALSE;
@@ -0,0 +1,60 @@
+package events
+
+// Wakes everything in this process that is watching a game when the game
+//  changes (a move, a seat claim, or a result)
+//
+// Notifications carry no data: subscribers re-read the game from the store,
+//  so several changes arriving close together are coalesced into one wakeup
+//  and nothing is lost if a subscriber falls behind.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "sync"
+)
+
+type Hub struct {
+    lock sync.Mutex
+    subscribers map[ID]map[chan struct{}]bool
+}
+
+func NewHub() *Hub {
+    h := new(Hub)
+    h.subscribers = make(map[ID]map[chan struct{}]bool)
+    return h
+}
+
+// Returns a channel which receives a value after each change to the game,
+//  and a function which must be called once the channel is no longer read
+func (h *Hub) Subscribe(gameID ID) (<-chan struct{}, func()) {
+    h.lock.Lock()
+    defer h.lock.Unlock()
+    wake := make(chan struct{}, 1)
+    if h.subscribers[gameID] == nil {
+        h.subscribers[gameID] = make(map[chan struct{}]bool)
+    }
+    h.subscribers[gameID][wake] = true
+
+    cancel := func() {
+        h.lock.Lock()
+        defer h.lock.Unlock()
+        delete(h.subscribers[gameID], wake)
+        if len(h.subscribers[gameID]) == 0 {
+            delete(h.subscribers, gameID)
+        }
+    }
+    return wake, cancel
+}
+
+// Wakes every subscriber to the game without blocking
+func (h *Hub) Notify(gameID ID) {
+    h.lock.Lock()
+    defer h.lock.Unlock()
+    for wake := range h.subscribers[gameID] {
+        select {
+        case wake <- struct{}{}:
+        default:
+            // A wakeup is already pending
+        }
+    }
+}
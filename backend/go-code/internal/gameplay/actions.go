@@ -0,0 +1,302 @@
+package gameplay
+
+// Resignations, abandoned seats, and draw offers
+//
+// A resigning seat leaves play, as does one which forfeits on time: its turns
+//  are passed from then on, and the game ends once only one seat is left in
+//  play, which wins. A two-player game therefore ends at once. A draw offer
+//  is agreed once every other human seat in play accepts it (AI seats go along
+//  with their human opponents), and lapses if any seat declines it or the next
+//  move is played first.
+//
+// Abandoning hands the seat to an AI so that the other players may finish the
+//  game, and the seat's player ID stops working; a leaving host passes the
+//  host role to another human player. With no other human seat left in play,
+//  it is the same as resigning.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "fmt"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/random"
+    "linegames/backend/internal/rules"
+)
+
+var (
+    ErrUnknownAction = errors.New("Unknown action")
+    ErrNoDrawOffer = errors.New("No draw offer from another seat is pending")
+    ErrSeatOut = errors.New("Seat is no longer in play")
+)
+
+// Stores the action taken by `seat`, and the game's result if the action
+//  ended the game.
+//
+// Errors wrapping ErrNotBegun, ErrUnknownAction, ErrNoDrawOffer, ErrSeatOut,
+//  or rules.ErrGameOver mean the action was rejected; any other error is a
+//  problem reaching the database.
+func TakeAction(store database.Store, game Game, seat int, action ActionType) error {
+    if !game.Begun {
+        return ErrNotBegun
+    }
+    if action < Resign || action > Abandon {
+        return fmt.Errorf("%w %d", ErrUnknownAction, action)
+    }
+    if err := EnforceClock(store, game); err != nil {
+        return err
+    }
+    _, over, err := store.GetResult(game.ID)
+    if err != nil {
+        return err
+    } else if over {
+        return rules.ErrGameOver
+    }
+    board, err := CurrentBoard(store, game)
+    if err != nil {
+        return err
+    }
+    out, err := seatsOut(store, game)
+    if err != nil {
+        return err
+    }
+    if _, isOut := out[seat]; isOut {
+        return ErrSeatOut
+    }
+
+    var accepted map[int]bool
+    if action == OfferDraw || action == AcceptDraw || action == DeclineDraw {
+        accepted, err = pendingDrawOffer(store, game.ID, board.Turn)
+        if err != nil {
+            return err
+        }
+        if action != OfferDraw && (accepted == nil || accepted[seat]) {
+            return ErrNoDrawOffer
+        }
+    }
+
+    if action == Abandon {
+        _, othersRemain, err := otherHuman(store, game.ID, seat, out)
+        if err != nil {
+            return err
+        } else if !othersRemain {
+            action = Resign
+        }
+    }
+
+    // Worked out before the action is stored, so that both are stored at once
+    var result *Result
+    switch action {
+    case Resign:
+        out[seat] = 0
+        result = lastSeatStanding(game, out, board.Turn, Resigned)
+    case OfferDraw, AcceptDraw:
+        if accepted == nil {
+            accepted = make(map[int]bool)
+        }
+        accepted[seat] = true
+        result, err = agreedDraw(store, game.ID, board.Turn, accepted, out)
+        if err != nil {
+            return err
+        }
+    }
+
+    err = store.InsertGameAction(&GameAction{GameID: game.ID, Seat: seat, Action: action, Turn: board.Turn},
+                                 result)
+    if errors.Is(err, database.ErrGameOver) {
+        return rules.ErrGameOver
+    } else if err != nil || result != nil {
+        return err
+    }
+
+    switch action {
+    case Resign:
+        // The resigning seat may hold the current turn
+        return EnforceClock(store, game)
+    case Abandon:
+        return handToAI(store, game, seat, out)
+    case OfferDraw, AcceptDraw:
+        // Seats accepting at the same moment each miss the other's acceptance
+        //  above, so the stored offer is checked once more
+        accepted, err = pendingDrawOffer(store, game.ID, board.Turn)
+        if err != nil {
+            return err
+        }
+        result, err = agreedDraw(store, game.ID, board.Turn, accepted, out)
+        if result == nil || err != nil {
+            return err
+        }
+        _, err = store.InsertResult(result)
+        return err
+    }
+    return nil
+}
+
+// True if `err` came from TakeAction rejecting the action itself
+func IsActionRejection(err error) bool {
+    return errors.Is(err, ErrNotBegun) || errors.Is(err, ErrUnknownAction) ||
+           errors.Is(err, ErrNoDrawOffer) || errors.Is(err, ErrSeatOut) ||
+           errors.Is(err, rules.ErrGameOver)
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Returns the seats which have left play while the game went on, with the
+//  time at which each one left: those which resigned, and those which ran
+//  out of time under the Forfeit policy
+func seatsOut(store database.Store, game Game) (map[int]Time, error) {
+    actions, err := store.GetGameActions(game.ID, 0)
+    if err != nil {
+        return nil, err
+    }
+    out := make(map[int]Time)
+    for _, a := range actions {
+        if a.Action == Resign {
+            out[a.Seat] = a.Timestamp
+        }
+    }
+
+    spec, found, err := store.GetSpec(game.ID)
+    if err != nil {
+        return nil, err
+    } else if !found {
+        return nil, fmt.Errorf("Game Spec for game_id %d not found.", game.ID)
+    }
+    if spec.Spec.Clock.OnTimeout != Forfeit {
+        return out, nil
+    }
+    // Without skipped turns, a seat's first pass is where it forfeited or
+    //  passed after resigning
+    moves, err := store.GetAllMoves(game.ID)
+    if err != nil {
+        return nil, err
+    }
+    for _, m := range moves {
+        seat := m.Turn % game.NumPlayers
+        if _, isOut := out[seat]; !isOut && rules.IsPass(m) {
+            out[seat] = m.Timestamp
+        }
+    }
+    return out, nil
+}
+
+// Returns the result if at most one seat is still in play, or nil if not
+func lastSeatStanding(game Game, out map[int]Time, turn int, reason EndReason) *Result {
+    winner := rules.NoWinner
+    for seat := 0; seat < game.NumPlayers; seat++ {
+        if _, isOut := out[seat]; isOut {
+            continue
+        }
+        if winner != rules.NoWinner {
+            return nil
+        }
+        winner = seat
+    }
+    return &Result{GameID: game.ID, Winner: winner, Line: []Position{}, Turn: turn, Reason: reason}
+}
+
+// Returns another seat in play held by a human player, if any
+func otherHuman(store database.Store, gameID ID, seat int, out map[int]Time) (Seat, bool, error) {
+    seats, err := store.GetSeats(gameID)
+    if err != nil {
+        return Seat{}, false, err
+    }
+    for _, s := range seats {
+        if _, isOut := out[s.Seat]; !isOut && s.Seat != seat && s.Type == Human && s.Claimed {
+            return s, true, nil
+        }
+    }
+    return Seat{}, false, nil
+}
+
+// Returns the result if every human seat in play has accepted the draw offer,
+//  or nil if not. AI seats go along with their human opponents.
+func agreedDraw(store database.Store, gameID ID, turn int, accepted map[int]bool,
+                out map[int]Time) (*Result, error) {
+    seats, err := store.GetSeats(gameID)
+    if err != nil {
+        return nil, err
+    }
+    for _, s := range seats {
+        if _, isOut := out[s.Seat]; !isOut && s.Type == Human && s.Claimed && !accepted[s.Seat] {
+            return nil, nil
+        }
+    }
+    return &Result{GameID: gameID, Winner: rules.NoWinner, Line: []Position{}, Turn: turn,
+                   Reason: DrawAgreed}, nil
+}
+
+// Hands the seat to an AI under a new player ID. If the seat's player was the
+//  host, another human player becomes the host first, so that the host
+//  controls stay usable.
+func handToAI(store database.Store, game Game, seat int, out map[int]Time) error {
+    leaving, found, err := store.GetSeat(game.ID, seat)
+    if err != nil {
+        return err
+    } else if !found {
+        return fmt.Errorf("Seat %d of game %d not found.", seat, game.ID)
+    }
+    if game.HostID != 0 && game.HostID == leaving.PlayerID {
+        // Only called while another human remains, but a game left without
+        //  one has no use for a host
+        newHost, _, err := otherHuman(store, game.ID, seat, out)
+        if err != nil {
+            return err
+        }
+        if err = store.SetHost(game.ID, newHost.PlayerID); err != nil {
+            return err
+        }
+    }
+    playerID, err := newPlayerID(store)
+    if err != nil {
+        return err
+    }
+    _, err = store.ConvertSeatToAI(game.ID, seat, true, playerID, Medium)
+    return err
+}
+
+// Player IDs share their namespace with spectator IDs, so neither may be used
+func newPlayerID(store database.Store) (ID, error) {
+    for {
+        playerID := random.JavaScriptFriendlyRandom64()
+        _, found, err := store.GetPlayer(playerID)
+        if err == nil && !found {
+            _, found, err = store.GetSpectator(playerID)
+        }
+        if err != nil {
+            return 0, err
+        } else if !found {
+            return playerID, nil
+        }
+    }
+}
+
+// Returns the seats which have made or accepted the draw offer pending on
+//  `turn`, or nil if there is none
+func pendingDrawOffer(store database.Store, gameID ID, turn int) (map[int]bool, error) {
+    actions, err := store.GetGameActions(gameID, 0)
+    if err != nil {
+        return nil, err
+    }
+    var accepted map[int]bool
+    for _, a := range actions {
+        if a.Turn != turn {
+            continue  // Offers lapse once the next move is played
+        }
+        switch a.Action {
+        case OfferDraw:
+            // A second offer joins the pending one rather than replacing it
+            if accepted == nil {
+                accepted = make(map[int]bool)
+            }
+            accepted[a.Seat] = true
+        case AcceptDraw:
+            if accepted != nil {
+                accepted[a.Seat] = true
+            }
+        case DeclineDraw:
+            accepted = nil
+        }
+    }
+    return accepted, nil
+}
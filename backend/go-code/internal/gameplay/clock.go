@@ -0,0 +1,169 @@
+package gameplay
+
+// Time controls, tracked from the time the game began and the timestamps of
+//  its moves
+//
+// Nothing runs when a clock expires; instead EnforceClock is called whenever
+//  a game is read or written, and records what the expiry would have done at
+//  the moment it happened. Skipped turns are stored as rules.Pass moves, as
+//  are the turns of seats which have left play.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "fmt"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/rules"
+    "math"
+    "time"
+)
+
+// Each seat's bank as of the start of the current turn (nil without a bank),
+//  and the time at which the current turn times out
+type Clock struct {
+    Banks []int
+    Deadline Time
+}
+
+func HasClock(tc TimeControl) bool {
+    return tc.PerMove > 0 || tc.Bank > 0
+}
+
+// Computes the clock for the turn after `moves`, which must be sorted by turn
+func ComputeClock(tc TimeControl, game Game, moves []Move) Clock {
+    var clock Clock
+    if tc.Bank > 0 {
+        clock.Banks = make([]int, game.NumPlayers)
+        for i := range clock.Banks {
+            clock.Banks[i] = tc.Bank
+        }
+    }
+    turnStart := game.BegunAt
+    for _, m := range moves {
+        if clock.Banks != nil {
+            seat := m.Turn % game.NumPlayers
+            used := int(m.Timestamp - turnStart)
+            clock.Banks[seat] = max(clock.Banks[seat] - used, 0) + tc.Increment
+        }
+        turnStart = m.Timestamp
+    }
+
+    allowed := math.MaxInt32
+    if tc.PerMove > 0 {
+        allowed = tc.PerMove
+    }
+    if clock.Banks != nil {
+        allowed = min(allowed, clock.Banks[len(moves) % game.NumPlayers])
+    }
+    clock.Deadline = turnStart + Time(allowed)
+    return clock
+}
+
+// Records every timeout which has happened in the game but is not stored yet:
+//  a pass for each skipped turn or forfeit, and the result once a forfeit
+//  leaves one seat in play. Turns of seats which have left play are passed as
+//  they come up, with or without a clock.
+//
+// If every seat's turn is skipped in a row, the game ends with no winner.
+func EnforceClock(store database.Store, game Game) error {
+    if !game.Begun {
+        return nil
+    }
+    spec, found, err := store.GetSpec(game.ID)
+    if err != nil {
+        return err
+    } else if !found {
+        return fmt.Errorf("Game Spec for game_id %d not found.", game.ID)
+    }
+    tc := spec.Spec.Clock
+
+    for {
+        _, over, err := store.GetResult(game.ID)
+        if over || err != nil {
+            return err
+        }
+        moves, err := store.GetAllMoves(game.ID)
+        if err != nil {
+            return err
+        }
+        board, err := rules.Replay(spec.Spec, game.NumPlayers, moves)
+        if err != nil {
+            return err
+        }
+        if board.GameOver() {
+            return nil
+        }
+        out, err := seatsOut(store, game)
+        if err != nil {
+            return err
+        }
+        if left, isOut := out[board.Player()]; isOut {
+            // The turn passes as soon as it begins, or as the seat leaves
+            turnStart := game.BegunAt
+            if len(moves) > 0 {
+                turnStart = moves[len(moves) - 1].Timestamp
+            }
+            if err = insertPass(store, game.ID, board.Turn, max(turnStart, left)); err != nil {
+                return err
+            }
+            continue
+        }
+        if !HasClock(tc) {
+            return nil
+        }
+        clock := ComputeClock(tc, game, moves)
+        if Time(time.Now().Unix()) < clock.Deadline {
+            return nil
+        }
+
+        if tc.OnTimeout == SkipTurn && !endsPassing(moves, game.NumPlayers - 1) {
+            if err = insertPass(store, game.ID, board.Turn, clock.Deadline); err != nil {
+                return err
+            }
+            continue
+        }
+
+        result := &Result{GameID: game.ID, Winner: rules.NoWinner, Line: []Position{}, Turn: board.Turn,
+                          Reason: TimedOut}
+        if tc.OnTimeout == Forfeit {
+            // The seat leaves play, and its pass marks when
+            out[board.Player()] = clock.Deadline
+            result = lastSeatStanding(game, out, board.Turn, TimedOut)
+            if result == nil {
+                if err = insertPass(store, game.ID, board.Turn, clock.Deadline); err != nil {
+                    return err
+                }
+                continue
+            }
+        }
+        _, err = store.InsertResult(result)
+        return err
+    }
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+func insertPass(store database.Store, gameID ID, turn int, timestamp Time) error {
+    pass := Move{GameID: gameID, Turn: turn, X: rules.Pass.X, Y: rules.Pass.Y, Timestamp: timestamp}
+    // Losing a race with another pass, a move, or a result is fine: the caller
+    //  loops and re-reads
+    _, err := store.InsertMoveIfAbsent(&pass, nil)
+    if errors.Is(err, database.ErrGameOver) {
+        return nil
+    }
+    return err
+}
+
+// True if the last `n` moves were all passes
+func endsPassing(moves []Move, n int) bool {
+    if len(moves) < n {
+        return false
+    }
+    for _, m := range moves[len(moves) - n:] {
+        if !rules.IsPass(m) {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,115 @@
+package gameplay
+
+// The path shared by everything that submits moves to a game (the gameplay
+//  server on behalf of players and the AI server on behalf of AI seats)
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "fmt"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/rules"
+    "math"
+)
+
+var (
+    ErrNotBegun = errors.New("Game has not begun")
+    ErrNotNextTurn = errors.New("Move is not for the next turn")
+    ErrIllegalMove = errors.New("Illegal move")
+)
+
+// Rebuilds the board as it stood before `turn` was played
+func ReplayBefore(store database.Store, game Game, turn int) (*rules.Board, error) {
+    spec, found, err := store.GetSpec(game.ID)
+    if err != nil {
+        return nil, err
+    } else if !found {
+        return nil, fmt.Errorf("Game Spec for game_id %d not found.", game.ID)
+    }
+    moves, err := store.GetAllMoves(game.ID)
+    if err != nil {
+        return nil, err
+    }
+    previous := make([]Move, 0, len(moves))
+    for _, m := range moves {
+        if m.Turn < turn {
+            previous = append(previous, m)
+        }
+    }
+    return rules.Replay(spec.Spec, game.NumPlayers, previous)
+}
+
+// Rebuilds the board with every move played so far
+func CurrentBoard(store database.Store, game Game) (*rules.Board, error) {
+    return ReplayBefore(store, game, math.MaxInt)
+}
+
+// Validates `move` against the game's history, stores it, and stores the
+//  game's result if the move ended the game.
+//
+// Returns false (and no error) if a move for this turn was already present,
+//  including when another submission for the turn was stored first.
+//
+// Errors wrapping ErrNotBegun, ErrNotNextTurn, or ErrIllegalMove mean the move
+//  was rejected; any other error is a problem reaching the database.
+//
+// A move for turn N is only accepted once turn N - 1 has been played, so the
+//  move log never has gaps.
+func SubmitMove(store database.Store, game Game, move *Move) (bool, error) {
+    if !game.Begun {
+        return false, ErrNotBegun
+    }
+    // A late move loses to the timeout which preceded it
+    if err := EnforceClock(store, game); err != nil {
+        return false, err
+    }
+    // A played turn is reported as such even once the game is over, so that
+    //  resubmitting the final move is not mistaken for a move after the end
+    _, alreadyPresent, err := store.GetMove(game.ID, move.Turn)
+    if err != nil {
+        return false, err
+    }
+    if alreadyPresent {
+        return false, nil
+    }
+
+    board, err := ReplayBefore(store, game, move.Turn)
+    if err != nil {
+        return false, err
+    }
+    if board.Turn != move.Turn {
+        // The previous turn has not been played yet
+        return false, fmt.Errorf("%w: next turn is %d, not %d", ErrNotNextTurn, board.Turn, move.Turn)
+    }
+    if err = board.CheckLegal(move.X, move.Y); err != nil {
+        return false, fmt.Errorf("%w: %w", ErrIllegalMove, err)
+    }
+
+    board.Play(move.X, move.Y)
+    var result *Result
+    if board.GameOver() {
+        result = new(Result)
+        result.GameID = move.GameID
+        result.Winner = board.Winner
+        result.Line = board.WinningLine
+        result.Turn = move.Turn
+    }
+    // Games may also end by resignation, agreement, or timeout, off the board,
+    //  which the store checks for along with the insertion
+    inserted, err := store.InsertMoveIfAbsent(move, result)
+    if errors.Is(err, database.ErrGameOver) {
+        return false, fmt.Errorf("%w: %w", ErrIllegalMove, rules.ErrGameOver)
+    } else if !inserted || result != nil || err != nil {
+        return inserted, err
+    }
+    // Passes the turns of any seats which have left play, so that the next
+    //  seat in play is up at once
+    return true, EnforceClock(store, game)
+}
+
+// True if `err` came from SubmitMove rejecting the move itself
+func IsRejection(err error) bool {
+    return errors.Is(err, ErrNotBegun) || errors.Is(err, ErrNotNextTurn) ||
+           errors.Is(err, ErrIllegalMove)
+}
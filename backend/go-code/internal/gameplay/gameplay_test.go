@@ -0,0 +1,215 @@
+package gameplay
+
+import (
+    "errors"
+    . "linegames/backend/internal/types"
+    "linegames/backend/internal/memstore"
+    "linegames/backend/internal/rules"
+    "testing"
+    "time"
+)
+
+const testGameID = 100
+
+// Stores a begun tic-tac-toe game with a claimed seat of each type, which
+//  began `begunAgo` seconds ago
+func newTestGame(t *testing.T, tc TimeControl, begunAgo int, seatTypes ...SeatType) (*memstore.MemoryStore, Game) {
+    game := Game{ID: testGameID, Name: "test", NumPlayers: len(seatTypes), Begun: true,
+                 BegunAt: Time(time.Now().Unix()) - Time(begunAgo)}
+    spec := Spec{GameID: testGameID}
+    spec.Spec.Board = GameBoard{Width: 3, Height: 3}
+    spec.Spec.Rules = GameRules{WinningLength: 3}
+    spec.Spec.Clock = tc
+
+    players := make([]Player, len(seatTypes))
+    seats := make([]Seat, len(seatTypes))
+    for i, seatType := range seatTypes {
+        players[i] = Player{ID: 200 + ID(i), GameID: testGameID}
+        seats[i] = Seat{GameID: testGameID, PlayerID: 200 + ID(i), Seat: i, Type: seatType, Claimed: true}
+    }
+    store := memstore.New()
+    if err := store.CreateGame(&game, &spec, players, seats); err != nil {
+        t.Fatalf("Could not create test game: %v", err)
+    }
+    return store, game
+}
+
+func submit(t *testing.T, store *memstore.MemoryStore, game Game, turn int, x int, y int) (bool, error) {
+    return SubmitMove(store, game, &Move{GameID: game.ID, Turn: turn, X: x, Y: y})
+}
+
+func TestSubmitMove(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, Human, Human)
+
+    if inserted, err := submit(t, store, game, 0, 1, 1); !inserted || err != nil {
+        t.Fatalf("Expected the first move to be stored, got %t %v", inserted, err)
+    }
+    // A duplicate turn is neither stored nor an error, whatever its move
+    if inserted, err := submit(t, store, game, 0, 0, 0); inserted || err != nil {
+        t.Errorf("Expected the duplicate turn to be ignored, got %t %v", inserted, err)
+    }
+    if _, err := submit(t, store, game, 2, 0, 0); !errors.Is(err, ErrNotNextTurn) {
+        t.Errorf("Expected ErrNotNextTurn, got %v", err)
+    }
+    if _, err := submit(t, store, game, 1, 1, 1); !errors.Is(err, ErrIllegalMove) {
+        t.Errorf("Expected ErrIllegalMove, got %v", err)
+    }
+    if move, _, _ := store.GetMove(game.ID, 0); move.X != 1 || move.Y != 1 {
+        t.Errorf("Expected the first move to stay stored, got %+v", move)
+    }
+}
+
+func TestSubmitMoveEndsGame(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, Human, Human)
+
+    for turn, cell := range []Position{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 0}} {
+        if _, err := submit(t, store, game, turn, cell.X, cell.Y); err != nil {
+            t.Fatalf("Expected move %d to be legal, got %v", turn, err)
+        }
+    }
+    result, over, _ := store.GetResult(game.ID)
+    if !over || result.Winner != 0 || result.Turn != 4 || len(result.Line) != 3 {
+        t.Fatalf("Expected seat 0 to win on turn 4, got %+v", result)
+    }
+    if _, err := submit(t, store, game, 5, 2, 2); !errors.Is(err, rules.ErrGameOver) {
+        t.Errorf("Expected rules.ErrGameOver for a move after the result, got %v", err)
+    }
+}
+
+func TestSubmitMoveAfterResult(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, Human, Human)
+
+    // The result comes from off the board, so only the store can catch it
+    if err := TakeAction(store, game, 0, Resign); err != nil {
+        t.Fatalf("Expected the resignation to be stored, got %v", err)
+    }
+    inserted, err := submit(t, store, game, 0, 1, 1)
+    if inserted || !errors.Is(err, ErrIllegalMove) || !errors.Is(err, rules.ErrGameOver) {
+        t.Errorf("Expected the move to be refused as illegal, got %t %v", inserted, err)
+    }
+    if _, found, _ := store.GetMove(game.ID, 0); found {
+        t.Errorf("Move stored after the result")
+    }
+}
+
+func TestTakeAction(t *testing.T) {
+    tests := []struct {
+        name string
+        seats []SeatType
+        actions []GameAction  // Only Seat and Action are used
+        over bool
+        winner int
+        reason EndReason
+    }{
+        {"resign with two players", []SeatType{Human, Human},
+         []GameAction{{Seat: 0, Action: Resign}}, true, 1, Resigned},
+        {"resign with three players", []SeatType{Human, Human, Human},
+         []GameAction{{Seat: 0, Action: Resign}}, false, 0, 0},
+        {"last seat left in play", []SeatType{Human, Human, Human},
+         []GameAction{{Seat: 0, Action: Resign}, {Seat: 2, Action: Resign}}, true, 1, Resigned},
+        {"draw with two players", []SeatType{Human, Human},
+         []GameAction{{Seat: 1, Action: OfferDraw}, {Seat: 0, Action: AcceptDraw}}, true, rules.NoWinner,
+         DrawAgreed},
+        {"draw awaiting a third player", []SeatType{Human, Human, Human},
+         []GameAction{{Seat: 0, Action: OfferDraw}, {Seat: 1, Action: AcceptDraw}}, false, 0, 0},
+        {"draw with three players", []SeatType{Human, Human, Human},
+         []GameAction{{Seat: 0, Action: OfferDraw}, {Seat: 1, Action: AcceptDraw}, {Seat: 2, Action: AcceptDraw}},
+         true, rules.NoWinner, DrawAgreed},
+        {"draw after a resignation", []SeatType{Human, Human, Human},
+         []GameAction{{Seat: 1, Action: Resign}, {Seat: 0, Action: OfferDraw}, {Seat: 2, Action: AcceptDraw}},
+         true, rules.NoWinner, DrawAgreed},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            store, game := newTestGame(t, TimeControl{}, 0, test.seats...)
+            for _, a := range test.actions {
+                if err := TakeAction(store, game, a.Seat, a.Action); err != nil {
+                    t.Fatalf("Expected action %d by seat %d to be stored, got %v", a.Action, a.Seat, err)
+                }
+            }
+            result, over, _ := store.GetResult(game.ID)
+            if over != test.over || (over && (result.Winner != test.winner || result.Reason != test.reason)) {
+                t.Errorf("Expected over %t with winner %d by %d, got %t %+v", test.over, test.winner,
+                         test.reason, over, result)
+            }
+            actions, _ := store.GetGameActions(game.ID, 0)
+            if len(actions) != len(test.actions) {
+                t.Errorf("Expected %d stored actions, got %d", len(test.actions), len(actions))
+            }
+        })
+    }
+}
+
+func TestResignedSeatIsSkipped(t *testing.T) {
+    store, game := newTestGame(t, TimeControl{}, 0, Human, Human, Human)
+
+    submit(t, store, game, 0, 0, 0)
+    if err := TakeAction(store, game, 1, Resign); err != nil {
+        t.Fatalf("Expected the resignation to be stored, got %v", err)
+    }
+    if move, found, _ := store.GetMove(game.ID, 1); !found || !rules.IsPass(move) {
+        t.Errorf("Expected the resigned seat's turn to pass, got %t %+v", found, move)
+    }
+    if err := TakeAction(store, game, 1, OfferDraw); !errors.Is(err, ErrSeatOut) {
+        t.Errorf("Expected ErrSeatOut, got %v", err)
+    }
+    if _, err := submit(t, store, game, 1, 1, 1); err != nil {
+        t.Errorf("Expected a move for the passed turn to be ignored, got %v", err)
+    }
+    if inserted, err := submit(t, store, game, 2, 1, 1); !inserted || err != nil {
+        t.Errorf("Expected seat 2 to move next, got %t %v", inserted, err)
+    }
+    if err := TakeAction(store, game, 0, Resign); err != nil {
+        t.Fatalf("Expected the resignation to be stored, got %v", err)
+    }
+    if result, _, _ := store.GetResult(game.ID); result.Winner != 2 || result.Reason != Resigned {
+        t.Errorf("Expected seat 2 to win as the last seat in play, got %+v", result)
+    }
+    if err := TakeAction(store, game, 2, Resign); !errors.Is(err, rules.ErrGameOver) {
+        t.Errorf("Expected rules.ErrGameOver after the result, got %v", err)
+    }
+}
+
+func TestEnforceClock(t *testing.T) {
+    tests := []struct {
+        name string
+        seats []SeatType
+        clock TimeControl
+        begunAgo int
+        over bool
+        winner int
+        passes int  // The number of turns passed
+    }{
+        {"in time", []SeatType{Human, Human}, TimeControl{PerMove: 30}, 15, false, 0, 0},
+        {"forfeit with two players", []SeatType{Human, Human}, TimeControl{PerMove: 30}, 45, true, 1, 0},
+        {"forfeit with three players", []SeatType{Human, Human, Human}, TimeControl{PerMove: 30}, 45,
+         false, 0, 1},
+        {"two forfeits with three players", []SeatType{Human, Human, Human}, TimeControl{PerMove: 30}, 75,
+         true, 2, 1},
+        {"skipped turn", []SeatType{Human, Human}, TimeControl{PerMove: 30, OnTimeout: SkipTurn}, 45,
+         false, 0, 1},
+        {"every turn skipped", []SeatType{Human, Human}, TimeControl{PerMove: 30, OnTimeout: SkipTurn}, 75,
+         true, rules.NoWinner, 1},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            store, game := newTestGame(t, test.clock, test.begunAgo, test.seats...)
+            if err := EnforceClock(store, game); err != nil {
+                t.Fatalf("EnforceClock failed: %v", err)
+            }
+            result, over, _ := store.GetResult(game.ID)
+            if over != test.over || (over && (result.Winner != test.winner || result.Reason != TimedOut)) {
+                t.Errorf("Expected over %t with winner %d, got %t %+v", test.over, test.winner, over, result)
+            }
+            moves, _ := store.GetAllMoves(game.ID)
+            if len(moves) != test.passes {
+                t.Errorf("Expected %d passes, got %+v", test.passes, moves)
+            }
+            for _, m := range moves {
+                if !rules.IsPass(m) || m.Timestamp != game.BegunAt + Time(30 * (m.Turn + 1)) {
+                    t.Errorf("Expected a pass as turn %d timed out, got %+v", m.Turn, m)
+                }
+            }
+        })
+    }
+}
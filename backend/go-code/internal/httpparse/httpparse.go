@@ -5,6 +5,7 @@ import (
     "net/http"
     "reflect"
     "strconv"
+    "strings"
 )
 
 // The functions in this file are adapted from The Go Programming Language
@@ -14,6 +15,10 @@ import (
 // Fills in all struct fields with a tag specified by `tag` with the
 //  corresponding param in the http request url
 //
+// Every tagged param is required unless its tag ends with ",optional" (for
+//  example `url:"wait,optional"`), in which case a missing param leaves the
+//  field unchanged.
+//
 // Handles strings, integers, booleans, and slices of the aforementioned
 func HttpParamsToStruct(r *http.Request, s interface{}, tag string) error {
     if err := r.ParseForm(); err != nil {
@@ -35,13 +40,14 @@ func fillStructWithStringsMap(m map[string][]string, s interface{}, tag string)
         fieldInfo := sVal.Type().Field(i)  // Metadata on the i'th field of s's type
         fieldTags := fieldInfo.Tag         // Metadata on the i'th field of s's type's tags
         name := fieldTags.Get(tag)         // The specific tag value of tag with name `tag`
+        name, optional := strings.CutSuffix(name, ",optional")
         if name == "" {  // No tag value for this field, or empty string tag value
             continue
         }
         fields[name] = sVal.Field(i)  // Essentially a pointer to the field
 
         // Double check that the field is present in the map
-        if _, check := m[name]; !check {
+        if _, check := m[name]; !check && !optional {
             return fmt.Errorf("Missing value for %s tag %s", tag, name)
         }
     }
@@ -105,7 +111,7 @@ func populate(value reflect.Value, s string) error {
             }
             value.SetInt(i)
         } else {
-            fmt.Errorf("Unsupported type %s", value.Type())
+            return fmt.Errorf("Unsupported type %s", value.Type())
         }
     }
 
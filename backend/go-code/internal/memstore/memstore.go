@@ -0,0 +1,718 @@
+package memstore
+
+// An in-memory database.Store for tests
+//
+// Mirrors the behavior of database.PostgresStore closely enough for handlers
+//  to be tested end to end: IDs are assigned the same way, timestamps are set
+//  on insertion, and multi-row operations are all-or-nothing.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "fmt"
+    "linegames/backend/internal/database"
+    "linegames/backend/internal/events"
+    "sort"
+    "sync"
+    "time"
+)
+
+var _ database.Store = (*MemoryStore)(nil)
+
+type MemoryStore struct {
+    lock sync.Mutex
+
+    games   map[ID]Game
+    specs   map[ID]Spec  // Keyed by game ID
+    players map[ID]Player
+    spectators map[ID]Spectator
+    seats   []Seat
+    moves   []Move
+    results map[ID]Result
+    actions []GameAction
+    chat    []ChatMessage
+    users   map[ID]User
+    sessions map[string]Session  // Keyed by token hash
+    hub *events.Hub
+
+    nextSpecID ID
+    nextSeatID uint
+    nextMoveID uint
+    nextActionID uint
+    nextChatID uint
+}
+
+func New() *MemoryStore {
+    ms := new(MemoryStore)
+    ms.games = make(map[ID]Game)
+    ms.specs = make(map[ID]Spec)
+    ms.players = make(map[ID]Player)
+    ms.spectators = make(map[ID]Spectator)
+    ms.seats = make([]Seat, 0)
+    ms.moves = make([]Move, 0)
+    ms.results = make(map[ID]Result)
+    ms.actions = make([]GameAction, 0)
+    ms.chat = make([]ChatMessage, 0)
+    ms.users = make(map[ID]User)
+    ms.sessions = make(map[string]Session)
+    ms.hub = events.NewHub()
+    ms.nextSpecID = 1
+    ms.nextSeatID = 1
+    ms.nextMoveID = 1
+    ms.nextActionID = 1
+    ms.nextChatID = 1
+    return ms
+}
+
+func (ms *MemoryStore) ValidLogin(gameID ID, password string) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    g, found := ms.games[gameID]
+    return found && g.Password == password, nil
+}
+
+func (ms *MemoryStore) GetNonBegunGames() ([]Game, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.filterGames(func(g Game) bool { return !g.Begun }), nil
+}
+
+func (ms *MemoryStore) SetBegun(gameID ID) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if g, found := ms.games[gameID]; found && !g.Begun {
+        g.Begun = true
+        g.BegunAt = now()
+        ms.games[gameID] = g
+    }
+    return nil
+}
+
+func (ms *MemoryStore) ClaimSeat(gameID ID, seat int, userID ID, displayName string) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for i := range ms.seats {
+        if ms.seats[i].GameID == gameID && ms.seats[i].Seat == seat && !ms.seats[i].Claimed {
+            ms.seats[i].Claimed = true
+            ms.seats[i].UserID = userID
+            ms.seats[i].DisplayName = displayName
+            ms.seats[i].LastSeen = now()
+            if p, found := ms.players[ms.seats[i].PlayerID]; found {
+                p.UserID = userID
+                ms.players[p.ID] = p
+            }
+            ms.hub.Notify(gameID)
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (ms *MemoryStore) RefreshGameTimestamp(gameID ID) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if g, found := ms.games[gameID]; found {
+        g.Timestamp = now()
+        ms.games[gameID] = g
+    }
+    return nil
+}
+
+func (ms *MemoryStore) SetLocked(gameID ID, locked bool) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if g, found := ms.games[gameID]; found {
+        g.Locked = locked
+        ms.games[gameID] = g
+    }
+    return nil
+}
+
+func (ms *MemoryStore) SetHost(gameID ID, hostID ID) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if g, found := ms.games[gameID]; found {
+        g.HostID = hostID
+        ms.games[gameID] = g
+    }
+    return nil
+}
+
+func (ms *MemoryStore) TouchSeat(playerID ID) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for i := range ms.seats {
+        if ms.seats[i].PlayerID == playerID {
+            ms.seats[i].LastSeen = now()
+        }
+    }
+    return nil
+}
+
+func (ms *MemoryStore) ReopenSeat(gameID ID, seat int, newPlayerID ID) (bool, error) {
+    return ms.replaceSeatPlayer(gameID, seat, newPlayerID,
+                                func(s Seat) bool { return s.Claimed },
+                                func(s *Seat) {
+                                    s.Claimed = false
+                                    s.UserID = 0
+                                    s.DisplayName = ""
+                                    s.LastSeen = 0
+                                })
+}
+
+func (ms *MemoryStore) ConvertSeatToAI(gameID ID, seat int, claimed bool, newPlayerID ID,
+                                       difficulty Difficulty) (bool, error) {
+    return ms.replaceSeatPlayer(gameID, seat, newPlayerID,
+                                func(s Seat) bool { return s.Claimed == claimed },
+                                func(s *Seat) {
+                                    s.Type = AI
+                                    s.Claimed = true
+                                    s.UserID = 0
+                                    s.DisplayName = ""
+                                    s.Difficulty = difficulty
+                                    s.LastSeen = 0
+                                })
+}
+
+func (ms *MemoryStore) SetRematch(gameID ID, rematchID ID) (ID, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    g, found := ms.games[gameID]
+    if !found {
+        return 0, fmt.Errorf("Game %d not found", gameID)
+    }
+    if g.RematchID == 0 {
+        g.RematchID = rematchID
+        ms.games[gameID] = g
+    }
+    return g.RematchID, nil
+}
+
+func (ms *MemoryStore) DeleteAllGameData(gameID ID) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    delete(ms.results, gameID)
+    ms.seats = filter(ms.seats, func(s Seat) bool { return s.GameID != gameID })
+    ms.moves = filter(ms.moves, func(m Move) bool { return m.GameID != gameID })
+    ms.actions = filter(ms.actions, func(a GameAction) bool { return a.GameID != gameID })
+    ms.chat = filter(ms.chat, func(m ChatMessage) bool { return m.GameID != gameID })
+    for id, p := range ms.players {
+        if p.GameID == gameID {
+            delete(ms.players, id)
+        }
+    }
+    for id, s := range ms.spectators {
+        if s.GameID == gameID {
+            delete(ms.spectators, id)
+        }
+    }
+    delete(ms.specs, gameID)
+    delete(ms.games, gameID)
+    return nil
+}
+
+func (ms *MemoryStore) GetOldGames(d Duration, begun bool) ([]Game, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    then := now() - Time(d)
+    return ms.filterGames(func(g Game) bool {
+        return g.Timestamp <= then && g.Begun == begun
+    }), nil
+}
+
+func (ms *MemoryStore) GetOldFinishedGames(d Duration) ([]Game, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    then := now() - Time(d)
+    return ms.filterGames(func(g Game) bool {
+        r, finished := ms.results[g.ID]
+        return finished && r.Timestamp <= then
+    }), nil
+}
+
+func (ms *MemoryStore) GetGamesAwaitingAI() ([]Game, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.filterGames(func(g Game) bool {
+        if _, finished := ms.results[g.ID]; finished || !g.Begun {
+            return false
+        }
+        turns := make(map[int]bool)
+        for _, m := range ms.moves {
+            if m.GameID == g.ID {
+                turns[m.Turn] = true
+            }
+        }
+        for _, s := range ms.seats {
+            if s.GameID == g.ID && s.Seat == len(turns) % g.NumPlayers {
+                return s.Type == AI
+            }
+        }
+        return false
+    }), nil
+}
+
+func (ms *MemoryStore) GetGame(gameID ID) (Game, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    g, found := ms.games[gameID]
+    return g, found, nil
+}
+
+func (ms *MemoryStore) GetSpec(gameID ID) (Spec, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    s, found := ms.specs[gameID]
+    return s, found, nil
+}
+
+func (ms *MemoryStore) GetPlayer(playerID ID) (Player, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    p, found := ms.players[playerID]
+    return p, found, nil
+}
+
+func (ms *MemoryStore) GetPlayers(gameID ID) ([]Player, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    result := make([]Player, 0)
+    for _, p := range ms.players {
+        if p.GameID == gameID {
+            result = append(result, p)
+        }
+    }
+    return result, nil
+}
+
+func (ms *MemoryStore) GetSpectator(spectatorID ID) (Spectator, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    s, found := ms.spectators[spectatorID]
+    return s, found, nil
+}
+
+func (ms *MemoryStore) GetPlayerSeat(playerID ID) (Seat, bool, error) {
+    return ms.firstSeat(func(s Seat) bool { return s.PlayerID == playerID })
+}
+
+func (ms *MemoryStore) GetSeat(gameID ID, seat int) (Seat, bool, error) {
+    return ms.firstSeat(func(s Seat) bool { return s.GameID == gameID && s.Seat == seat })
+}
+
+func (ms *MemoryStore) GetSeats(gameID ID) ([]Seat, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    seats := filter(ms.seats, func(s Seat) bool { return s.GameID == gameID })
+    sort.Slice(seats, func(i, j int) bool { return seats[i].Seat < seats[j].Seat })
+    return seats, nil
+}
+
+func (ms *MemoryStore) GetEmptySeats(gameID ID) ([]Seat, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return filter(ms.seats, func(s Seat) bool { return s.GameID == gameID && !s.Claimed }), nil
+}
+
+func (ms *MemoryStore) GetAISeats(gameID ID) ([]Seat, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return filter(ms.seats, func(s Seat) bool { return s.GameID == gameID && s.Type == AI }), nil
+}
+
+func (ms *MemoryStore) GetMove(gameID ID, turn int) (Move, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for _, m := range ms.moves {
+        if m.GameID == gameID && m.Turn == turn {
+            return m, true, nil
+        }
+    }
+    return Move{}, false, nil
+}
+
+func (ms *MemoryStore) GetAllMoves(gameID ID) ([]Move, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    result := filter(ms.moves, func(m Move) bool { return m.GameID == gameID })
+    sort.SliceStable(result, func(i, j int) bool {
+        return result[i].Turn < result[j].Turn
+    })
+    return result, nil
+}
+
+func (ms *MemoryStore) GetMoves(gameID ID, fromTurn int, limit int) ([]Move, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    result := filter(ms.moves, func(m Move) bool { return m.GameID == gameID && m.Turn >= fromTurn })
+    sort.Slice(result, func(i, j int) bool {
+        return result[i].Turn < result[j].Turn
+    })
+    if limit > 0 && len(result) > limit {
+        result = result[:limit]
+    }
+    return result, nil
+}
+
+func (ms *MemoryStore) GetResult(gameID ID) (Result, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    r, found := ms.results[gameID]
+    return r, found, nil
+}
+
+func (ms *MemoryStore) GetGameActions(gameID ID, afterID uint) ([]GameAction, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    // IDs increase in insertion order, so `actions` is already sorted by ID
+    return filter(ms.actions, func(a GameAction) bool { return a.GameID == gameID && a.ID > afterID }), nil
+}
+
+func (ms *MemoryStore) GetChatMessages(gameID ID, afterID uint, limit int) ([]ChatMessage, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    // IDs increase in insertion order, so `chat` is already sorted by ID
+    result := filter(ms.chat, func(m ChatMessage) bool { return m.GameID == gameID && m.ID > afterID })
+    if len(result) > limit {
+        result = result[:limit]
+    }
+    return result, nil
+}
+
+func (ms *MemoryStore) CountRecentChatMessages(gameID ID, seat int, d Duration) (int, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    then := now() - Time(d)
+    recent := filter(ms.chat, func(m ChatMessage) bool {
+        return m.GameID == gameID && m.Seat == seat && m.Timestamp > then
+    })
+    return len(recent), nil
+}
+
+func (ms *MemoryStore) GetUser(userID ID) (User, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    u, found := ms.users[userID]
+    return u, found, nil
+}
+
+func (ms *MemoryStore) GetUserByName(username string) (User, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for _, u := range ms.users {
+        if u.Username == username {
+            return u, true, nil
+        }
+    }
+    return User{}, false, nil
+}
+
+func (ms *MemoryStore) GetSession(tokenHash string) (Session, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    s, found := ms.sessions[tokenHash]
+    if !found || s.Expires <= now() {
+        return Session{}, false, nil
+    }
+    return s, true, nil
+}
+
+func (ms *MemoryStore) InsertGame(game *Game) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.insertGame(game)
+}
+
+func (ms *MemoryStore) InsertSpec(spec *Spec) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.insertSpec(spec)
+}
+
+func (ms *MemoryStore) InsertPlayer(player *Player) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.insertPlayer(player)
+}
+
+func (ms *MemoryStore) InsertSpectator(spectator *Spectator) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.games[spectator.GameID]; !found {
+        return fmt.Errorf("Spectator references missing game %d", spectator.GameID)
+    }
+    if _, found := ms.spectators[spectator.ID]; found {
+        return fmt.Errorf("Spectator %d already exists", spectator.ID)
+    }
+    stored := *spectator
+    stored.Timestamp = now()
+    ms.spectators[spectator.ID] = stored
+    return nil
+}
+
+func (ms *MemoryStore) InsertSeat(seat *Seat) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    return ms.insertSeat(seat)
+}
+
+func (ms *MemoryStore) InsertMoveIfAbsent(move *Move, result *Result) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.games[move.GameID]; !found {
+        return false, fmt.Errorf("Move references missing game %d", move.GameID)
+    }
+    for _, m := range ms.moves {
+        if m.GameID == move.GameID && m.Turn == move.Turn {
+            return false, nil
+        }
+    }
+    if _, over := ms.results[move.GameID]; over {
+        return false, database.ErrGameOver
+    }
+    stored := *move
+    stored.ID = ms.nextMoveID
+    ms.nextMoveID++
+    if stored.Timestamp == 0 {
+        stored.Timestamp = now()
+    }
+    ms.moves = append(ms.moves, stored)
+    if result != nil {
+        ms.insertResult(result)
+    }
+    ms.hub.Notify(move.GameID)
+    return true, nil
+}
+
+func (ms *MemoryStore) InsertResult(result *Result) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.games[result.GameID]; !found {
+        return false, fmt.Errorf("Result references missing game %d", result.GameID)
+    }
+    if !ms.insertResult(result) {
+        return false, nil
+    }
+    ms.hub.Notify(result.GameID)
+    return true, nil
+}
+
+func (ms *MemoryStore) Subscribe(gameID ID) (<-chan struct{}, func()) {
+    return ms.hub.Subscribe(gameID)
+}
+
+func (ms *MemoryStore) InsertUser(user *User) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.users[user.ID]; found {
+        return false, fmt.Errorf("User %d already exists", user.ID)
+    }
+    for _, u := range ms.users {
+        if u.Username == user.Username {
+            return false, nil
+        }
+    }
+    stored := *user
+    stored.Timestamp = now()
+    ms.users[user.ID] = stored
+    return true, nil
+}
+
+func (ms *MemoryStore) InsertGameAction(action *GameAction, result *Result) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.games[action.GameID]; !found {
+        return fmt.Errorf("Game action references missing game %d", action.GameID)
+    }
+    if _, over := ms.results[action.GameID]; over {
+        return database.ErrGameOver
+    }
+    stored := *action
+    stored.ID = ms.nextActionID
+    ms.nextActionID++
+    stored.Timestamp = now()
+    ms.actions = append(ms.actions, stored)
+    if result != nil {
+        ms.insertResult(result)
+    }
+    ms.hub.Notify(action.GameID)
+    return nil
+}
+
+func (ms *MemoryStore) InsertChatMessage(message *ChatMessage) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.games[message.GameID]; !found {
+        return fmt.Errorf("Chat message references missing game %d", message.GameID)
+    }
+    stored := *message
+    stored.ID = ms.nextChatID
+    ms.nextChatID++
+    stored.Timestamp = now()
+    ms.chat = append(ms.chat, stored)
+    return nil
+}
+
+func (ms *MemoryStore) InsertSession(session *Session) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    if _, found := ms.users[session.UserID]; !found {
+        return fmt.Errorf("Session references missing user %d", session.UserID)
+    }
+    ms.sessions[session.TokenHash] = *session
+    return nil
+}
+
+func (ms *MemoryStore) DeleteSession(tokenHash string) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    delete(ms.sessions, tokenHash)
+    return nil
+}
+
+func (ms *MemoryStore) DeleteExpiredSessions() error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for hash, s := range ms.sessions {
+        if s.Expires <= now() {
+            delete(ms.sessions, hash)
+        }
+    }
+    return nil
+}
+
+func (ms *MemoryStore) CreateGame(game *Game, spec *Spec, players []Player, seats []Seat) error {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+
+    // Check everything first so that nothing is inserted if anything fails
+    if _, found := ms.games[game.ID]; found {
+        return fmt.Errorf("Game %d already exists", game.ID)
+    }
+    for i := range players {
+        if _, found := ms.players[players[i].ID]; found {
+            return fmt.Errorf("Player %d already exists", players[i].ID)
+        }
+    }
+
+    ms.insertGame(game)
+    ms.insertSpec(spec)
+    for i := range players {
+        ms.insertPlayer(&players[i])
+    }
+    for i := range seats {
+        ms.insertSeat(&seats[i])
+    }
+    return nil
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// The insert functions below assume the lock is held
+
+func (ms *MemoryStore) insertGame(game *Game) error {
+    if _, found := ms.games[game.ID]; found {
+        return fmt.Errorf("Game %d already exists", game.ID)
+    }
+    stored := *game
+    stored.Timestamp = now()
+    if stored.Begun && stored.BegunAt == 0 {
+        stored.BegunAt = now()
+    }
+    ms.games[game.ID] = stored
+    return nil
+}
+
+func (ms *MemoryStore) insertSpec(spec *Spec) error {
+    stored := *spec
+    stored.ID = ms.nextSpecID
+    ms.nextSpecID++
+    ms.specs[spec.GameID] = stored
+    return nil
+}
+
+func (ms *MemoryStore) insertPlayer(player *Player) error {
+    if _, found := ms.players[player.ID]; found {
+        return fmt.Errorf("Player %d already exists", player.ID)
+    }
+    ms.players[player.ID] = *player
+    return nil
+}
+
+// Returns false if the game already has a result
+func (ms *MemoryStore) insertResult(result *Result) bool {
+    if _, found := ms.results[result.GameID]; found {
+        return false
+    }
+    stored := *result
+    stored.Line = append([]Position{}, result.Line...)
+    stored.Timestamp = now()
+    ms.results[result.GameID] = stored
+    return true
+}
+
+func (ms *MemoryStore) insertSeat(seat *Seat) error {
+    stored := *seat
+    stored.ID = ms.nextSeatID
+    ms.nextSeatID++
+    ms.seats = append(ms.seats, stored)
+    return nil
+}
+
+// Mirrors the Postgres helper of the same name
+func (ms *MemoryStore) replaceSeatPlayer(gameID ID, seat int, newPlayerID ID,
+                                         condition func(s Seat) bool, set func(s *Seat)) (bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for i := range ms.seats {
+        s := &ms.seats[i]
+        if s.GameID != gameID || s.Seat != seat || s.Type != Human || !condition(*s) {
+            continue
+        }
+        if _, found := ms.players[newPlayerID]; found {
+            return false, fmt.Errorf("Player %d already exists", newPlayerID)
+        }
+        delete(ms.players, s.PlayerID)
+        ms.players[newPlayerID] = Player{ID: newPlayerID, GameID: gameID}
+        s.PlayerID = newPlayerID
+        set(s)
+        ms.hub.Notify(gameID)
+        return true, nil
+    }
+    return false, nil
+}
+
+func (ms *MemoryStore) filterGames(keep func(g Game) bool) []Game {
+    result := make([]Game, 0)
+    for _, g := range ms.games {
+        if keep(g) {
+            result = append(result, g)
+        }
+    }
+    return result
+}
+
+func (ms *MemoryStore) firstSeat(match func(s Seat) bool) (Seat, bool, error) {
+    ms.lock.Lock()
+    defer ms.lock.Unlock()
+    for _, s := range ms.seats {
+        if match(s) {
+            return s, true, nil
+        }
+    }
+    return Seat{}, false, nil
+}
+
+func filter[T any](slice []T, keep func(t T) bool) []T {
+    result := make([]T, 0)
+    for _, t := range slice {
+        if keep(t) {
+            result = append(result, t)
+        }
+    }
+    return result
+}
+
+func now() Time {
+    return Time(time.Now().Unix())
+}
@@ -0,0 +1,303 @@
+package rules
+
+// Server-side replay of line games, mirroring the client's `Game` class
+//  (client/src/app/model/game.ts) so that the backend can judge which moves
+//  are legal instead of trusting whatever coordinates it is sent.
+
+// Import the exported project types without a prefix
+import . "linegames/backend/internal/types"
+import (
+    "errors"
+    "fmt"
+)
+
+const (
+    Empty = -1  // Board value of a cell that no player occupies
+    NoWinner = -1
+
+    MaxBoardSize = 30  // Max width or height of a board
+)
+
+var (
+    ErrOutOfBounds = errors.New("Move is outside the board")
+    ErrOccupied    = errors.New("Cell is already occupied")
+    ErrGravity     = errors.New("Cell below the move is empty on a gravity board")
+    ErrGameOver    = errors.New("Game is already over")
+)
+
+// The position of a stored move which skipped a turn without placing a stone,
+//  as when a seat runs out of time
+var Pass = Position{X: -1, Y: -1}
+
+type Board struct {
+    Spec GameSpec
+    NumPlayers int
+    Turn int
+    // Accessed as Cells[row][column], i.e. Cells[y][x]
+    Cells [][]int
+    // Each player's total captures
+    Captures []int
+    // The winning seat, or NoWinner
+    Winner int
+    // The cells of the winning line, if the game was won by a line
+    WinningLine []Position
+    // Total number of stones on the board
+    Placed int
+}
+
+// Returns an error describing the first problem with the spec, if any
+func ValidateSpec(spec GameSpec) error {
+    if spec.Board.Width < 1 || spec.Board.Width > MaxBoardSize {
+        return fmt.Errorf("Board width %d not in range [1, %d]", spec.Board.Width, MaxBoardSize)
+    }
+    if spec.Board.Height < 1 || spec.Board.Height > MaxBoardSize {
+        return fmt.Errorf("Board height %d not in range [1, %d]", spec.Board.Height, MaxBoardSize)
+    }
+    if spec.Rules.WinningLength < 1 {
+        return fmt.Errorf("Winning length %d must be positive", spec.Rules.WinningLength)
+    }
+    if spec.Rules.AllowCaptures && spec.Rules.CaptureSize < 1 {
+        return fmt.Errorf("Capture size %d must be positive", spec.Rules.CaptureSize)
+    }
+    if spec.Rules.WinByCaptures && !spec.Rules.AllowCaptures {
+        return fmt.Errorf("Winning by captures requires captures to be allowed")
+    }
+    if spec.Rules.WinByCaptures && spec.Rules.WinningNumCaptures < 1 {
+        return fmt.Errorf("Winning number of captures %d must be positive", spec.Rules.WinningNumCaptures)
+    }
+    clock := spec.Clock
+    if clock.PerMove < 0 || clock.Bank < 0 || clock.Increment < 0 {
+        return fmt.Errorf("Clock times must not be negative")
+    }
+    if clock.Increment > 0 && clock.Bank == 0 {
+        return fmt.Errorf("Clock increments require a bank")
+    }
+    if clock.OnTimeout != Forfeit && clock.OnTimeout != SkipTurn {
+        return fmt.Errorf("Unknown timeout action %d", clock.OnTimeout)
+    }
+    return nil
+}
+
+func NewBoard(spec GameSpec, numPlayers int) *Board {
+    b := new(Board)
+    b.Spec = spec
+    b.NumPlayers = numPlayers
+    b.Turn = 0
+    b.Cells = make([][]int, spec.Board.Height)
+    for y := 0; y < spec.Board.Height; y++ {
+        b.Cells[y] = make([]int, spec.Board.Width)
+        for x := 0; x < spec.Board.Width; x++ {
+            b.Cells[y][x] = Empty
+        }
+    }
+    b.Captures = make([]int, numPlayers)
+    b.Winner = NoWinner
+    b.WinningLine = make([]Position, 0)
+    b.Placed = 0
+    return b
+}
+
+// Plays `moves` in order on a fresh board.
+//
+// `moves` must be sorted by turn. A move for a turn that has already been
+//  played is ignored.
+func Replay(spec GameSpec, numPlayers int, moves []Move) (*Board, error) {
+    if err := ValidateSpec(spec); err != nil {
+        return nil, err
+    }
+    if numPlayers < 1 {
+        return nil, fmt.Errorf("Number of players %d must be positive", numPlayers)
+    }
+    b := NewBoard(spec, numPlayers)
+    for _, m := range moves {
+        if m.Turn < b.Turn {
+            continue
+        }
+        if m.Turn > b.Turn {
+            return nil, fmt.Errorf("Move history skips from turn %d to turn %d", b.Turn, m.Turn)
+        }
+        var err error
+        if IsPass(m) {
+            err = b.Pass()
+        } else {
+            _, err = b.Play(m.X, m.Y)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("Stored move for turn %d is illegal: %v", m.Turn, err)
+        }
+    }
+    return b, nil
+}
+
+func (b *Board) Copy() *Board {
+    c := new(Board)
+    *c = *b
+    c.Cells = make([][]int, len(b.Cells))
+    for y := 0; y < len(b.Cells); y++ {
+        c.Cells[y] = append([]int{}, b.Cells[y]...)
+    }
+    c.Captures = append([]int{}, b.Captures...)
+    c.WinningLine = append([]Position{}, b.WinningLine...)
+    return c
+}
+
+// A copy of the board in the shape sent to clients
+func (b *Board) State() GameState {
+    c := b.Copy()
+    return GameState{Player: c.Player(), Turn: c.Turn, Board: c.Cells, Captures: c.Captures}
+}
+
+// The seat whose turn it is
+func (b *Board) Player() int {
+    return b.Turn % b.NumPlayers
+}
+
+func (b *Board) InBounds(x, y int) bool {
+    return 0 <= y && y < b.Spec.Board.Height &&
+           0 <= x && x < b.Spec.Board.Width
+}
+
+func (b *Board) IsFull() bool {
+    return b.Placed == b.Spec.Board.Width * b.Spec.Board.Height
+}
+
+// True if someone has won or the board is full
+func (b *Board) GameOver() bool {
+    return b.Winner != NoWinner || b.IsFull()
+}
+
+// Returns nil if the current player may place a stone at (x, y)
+func (b *Board) CheckLegal(x, y int) error {
+    if b.GameOver() {
+        return ErrGameOver
+    }
+    if !b.InBounds(x, y) {
+        return ErrOutOfBounds
+    }
+    if b.Cells[y][x] != Empty {
+        return ErrOccupied
+    }
+    if b.Spec.Board.Gravity && y < b.Spec.Board.Height - 1 &&
+            b.Cells[y + 1][x] == Empty {
+        return ErrGravity
+    }
+    return nil
+}
+
+// Every cell where the current player may place a stone
+func (b *Board) LegalMoves() []Position {
+    legal := make([]Position, 0)
+    for y := 0; y < b.Spec.Board.Height; y++ {
+        for x := 0; x < b.Spec.Board.Width; x++ {
+            if b.CheckLegal(x, y) == nil {
+                legal = append(legal, Position{X: x, Y: y})
+            }
+        }
+    }
+    return legal
+}
+
+// Places the current player's stone at (x, y) and advances the turn.
+//
+// Returns the cells which opened up due to captures.
+func (b *Board) Play(x, y int) ([]Position, error) {
+    if err := b.CheckLegal(x, y); err != nil {
+        return nil, err
+    }
+    b.Cells[y][x] = b.Player()
+    captured := b.performCaptures(x, y)
+    b.checkForVictor(x, y)
+    b.Placed += 1 - len(captured)
+    b.Turn++
+    return captured, nil
+}
+
+// Advances the turn without placing a stone
+func (b *Board) Pass() error {
+    if b.GameOver() {
+        return ErrGameOver
+    }
+    b.Turn++
+    return nil
+}
+
+func IsPass(m Move) bool {
+    return m.X == Pass.X && m.Y == Pass.Y
+}
+
+/////////////////////////// Non-Exported Functions ////////////////////////////
+
+// Assumes (x, y) has already been placed on the board by the relevant player
+func (b *Board) performCaptures(x, y int) []Position {
+    captured := make([]Position, 0)
+    if !b.Spec.Rules.AllowCaptures {
+        return captured
+    }
+
+    player := b.Cells[y][x]
+    capSize := b.Spec.Rules.CaptureSize
+
+    for i := -1; i < 2; i++ {
+        for j := -1; j < 2; j++ {
+            if i == 0 && j == 0 {
+                continue
+            }
+            // The stone on the far side of the captured run must be ours
+            xAlt := x + (capSize + 1) * j
+            yAlt := y + (capSize + 1) * i
+            if !b.InBounds(xAlt, yAlt) || b.Cells[yAlt][xAlt] != player {
+                continue
+            }
+            isCapture := true
+            for k := 1; k <= capSize; k++ {
+                c := b.Cells[y + k * i][x + k * j]
+                if c == player || c == Empty {
+                    isCapture = false
+                    break
+                }
+            }
+            if !isCapture {
+                continue
+            }
+            b.Captures[player]++
+            for k := 1; k <= capSize; k++ {
+                b.Cells[y + k * i][x + k * j] = Empty
+                captured = append(captured, Position{X: x + k * j, Y: y + k * i})
+            }
+        }
+    }
+    return captured
+}
+
+// Assumes (x, y) has already been placed on the board by the relevant player
+//
+// Also assumes that all capture information is up to date
+func (b *Board) checkForVictor(x, y int) {
+    player := b.Cells[y][x]
+
+    if b.Spec.Rules.WinByCaptures &&
+            b.Captures[player] >= b.Spec.Rules.WinningNumCaptures {
+        b.Winner = player
+        return
+    }
+
+    // Vertical, horizontal, and the two diagonals
+    directions := [4][2]int{ {0, 1}, {1, 0}, {1, 1}, {1, -1} }
+    for _, d := range directions {
+        line := []Position{Position{X: x, Y: y}}
+        for sign := -1; sign < 2; sign += 2 {
+            xAlt := x + d[0] * sign
+            yAlt := y + d[1] * sign
+            for b.InBounds(xAlt, yAlt) && b.Cells[yAlt][xAlt] == player {
+                line = append(line, Position{X: xAlt, Y: yAlt})
+                xAlt += d[0] * sign
+                yAlt += d[1] * sign
+            }
+        }
+        if len(line) >= b.Spec.Rules.WinningLength {
+            b.Winner = player
+            b.WinningLine = line
+            return
+        }
+    }
+}
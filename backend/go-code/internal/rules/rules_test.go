@@ -0,0 +1,184 @@
+package rules
+
+import (
+    . "linegames/backend/internal/types"
+    "testing"
+)
+
+func testSpec(width, height int, gravity bool) GameSpec {
+    var spec GameSpec
+    spec.Board = GameBoard{Width: width, Height: height, Gravity: gravity}
+    spec.Rules = GameRules{WinningLength: 3}
+    return spec
+}
+
+func TestIllegalMoves(t *testing.T) {
+    b := NewBoard(testSpec(3, 3, false), 2)
+    if _, err := b.Play(3, 0); err != ErrOutOfBounds {
+        t.Errorf("Expected ErrOutOfBounds, got %v", err)
+    }
+    if _, err := b.Play(1, 1); err != nil {
+        t.Errorf("Expected legal move, got %v", err)
+    }
+    if _, err := b.Play(1, 1); err != ErrOccupied {
+        t.Errorf("Expected ErrOccupied, got %v", err)
+    }
+    if b.Turn != 1 || b.Player() != 1 {
+        t.Errorf("Wrong turn %d or player %d", b.Turn, b.Player())
+    }
+}
+
+func TestGravity(t *testing.T) {
+    b := NewBoard(testSpec(4, 4, true), 2)
+    if _, err := b.Play(0, 0); err != ErrGravity {
+        t.Errorf("Expected ErrGravity, got %v", err)
+    }
+    if _, err := b.Play(0, 3); err != nil {
+        t.Errorf("Expected legal move on bottom row, got %v", err)
+    }
+    if _, err := b.Play(0, 2); err != nil {
+        t.Errorf("Expected legal move on stacked stone, got %v", err)
+    }
+}
+
+func TestCaptures(t *testing.T) {
+    spec := testSpec(6, 6, false)
+    spec.Rules.WinningLength = 5
+    spec.Rules.AllowCaptures = true
+    spec.Rules.CaptureSize = 2
+    moves := []Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 1, Y: 0},
+        Move{Turn: 2, X: 5, Y: 5},
+        Move{Turn: 3, X: 2, Y: 0},
+        Move{Turn: 4, X: 3, Y: 0},  // Captures (1, 0) and (2, 0)
+    }
+    b, err := Replay(spec, 2, moves)
+    if err != nil {
+        t.Fatalf("Unexpected replay error: %v", err)
+    }
+    if b.Cells[0][1] != Empty || b.Cells[0][2] != Empty {
+        t.Errorf("Captured stones were not removed")
+    }
+    if b.Captures[0] != 1 || b.Captures[1] != 0 {
+        t.Errorf("Wrong captures %v", b.Captures)
+    }
+    // The captured cells can be played again
+    if _, err = b.Play(1, 0); err != nil {
+        t.Errorf("Expected legal move on captured cell, got %v", err)
+    }
+}
+
+func TestReplayHistory(t *testing.T) {
+    spec := testSpec(3, 3, false)
+    duplicate := []Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 0, X: 1, Y: 1},
+        Move{Turn: 1, X: 2, Y: 2},
+    }
+    b, err := Replay(spec, 2, duplicate)
+    if err != nil {
+        t.Fatalf("Unexpected replay error: %v", err)
+    }
+    if b.Turn != 2 || b.Cells[1][1] != Empty || b.Cells[0][0] != 0 {
+        t.Errorf("Duplicate turn was not ignored")
+    }
+
+    gap := []Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 2, X: 2, Y: 2},
+    }
+    if _, err = Replay(spec, 2, gap); err == nil {
+        t.Errorf("Expected an error for a gap in the move history")
+    }
+
+    if _, err = Replay(testSpec(0, 3, false), 2, nil); err == nil {
+        t.Errorf("Expected an error for an invalid spec")
+    }
+}
+
+func TestLineVictory(t *testing.T) {
+    spec := testSpec(3, 3, false)
+    moves := []Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 0, Y: 1},
+        Move{Turn: 2, X: 1, Y: 1},
+        Move{Turn: 3, X: 0, Y: 2},
+        Move{Turn: 4, X: 2, Y: 2},
+    }
+    b, err := Replay(spec, 2, moves)
+    if err != nil {
+        t.Fatalf("Unexpected replay error: %v", err)
+    }
+    if b.Winner != 0 || len(b.WinningLine) != 3 {
+        t.Errorf("Expected seat 0 to win with a diagonal, got %d %v", b.Winner, b.WinningLine)
+    }
+    if _, err = b.Play(2, 0); err != ErrGameOver {
+        t.Errorf("Expected ErrGameOver, got %v", err)
+    }
+}
+
+func TestCaptureVictoryAndDraw(t *testing.T) {
+    spec := testSpec(6, 6, false)
+    spec.Rules.WinningLength = 5
+    spec.Rules.AllowCaptures = true
+    spec.Rules.CaptureSize = 2
+    spec.Rules.WinByCaptures = true
+    spec.Rules.WinningNumCaptures = 1
+    moves := []Move{
+        Move{Turn: 0, X: 0, Y: 0},
+        Move{Turn: 1, X: 1, Y: 0},
+        Move{Turn: 2, X: 5, Y: 5},
+        Move{Turn: 3, X: 2, Y: 0},
+        Move{Turn: 4, X: 3, Y: 0},
+    }
+    b, err := Replay(spec, 2, moves)
+    if err != nil {
+        t.Fatalf("Unexpected replay error: %v", err)
+    }
+    if b.Winner != 0 || len(b.WinningLine) != 0 {
+        t.Errorf("Expected seat 0 to win by captures, got %d %v", b.Winner, b.WinningLine)
+    }
+
+    b = NewBoard(testSpec(2, 1, false), 2)
+    b.Play(0, 0)
+    b.Play(1, 0)
+    if !b.GameOver() || b.Winner != NoWinner {
+        t.Errorf("Expected a draw on a full board")
+    }
+}
+
+func TestPasses(t *testing.T) {
+    spec := testSpec(3, 3, false)
+    moves := []Move{
+        Move{Turn: 0, X: 1, Y: 1},
+        Move{Turn: 1, X: Pass.X, Y: Pass.Y},
+        Move{Turn: 2, X: 0, Y: 0},
+    }
+    b, err := Replay(spec, 2, moves)
+    if err != nil {
+        t.Fatalf("Unexpected replay error: %v", err)
+    }
+    if b.Turn != 3 || b.Player() != 1 || b.Cells[0][0] != 0 || b.Placed != 2 {
+        t.Errorf("Pass did not skip seat 1's turn: turn %d, cells %v", b.Turn, b.Cells)
+    }
+    if b.CheckLegal(Pass.X, Pass.Y) == nil {
+        t.Errorf("A pass should not be a legal placement")
+    }
+}
+
+func TestClockValidation(t *testing.T) {
+    spec := testSpec(3, 3, false)
+    spec.Clock = TimeControl{Bank: 300, Increment: 5, OnTimeout: SkipTurn}
+    if err := ValidateSpec(spec); err != nil {
+        t.Errorf("Expected a valid clock, got %v", err)
+    }
+    spec.Clock = TimeControl{PerMove: 30, Increment: 5}
+    if err := ValidateSpec(spec); err == nil {
+        t.Errorf("Expected an error for an increment without a bank")
+    }
+    spec.Clock = TimeControl{PerMove: -1}
+    if err := ValidateSpec(spec); err == nil {
+        t.Errorf("Expected an error for a negative limit")
+    }
+}
@@ -2,6 +2,10 @@ package types
 
 type ID = int64
 type SeatType int
+type Difficulty int
+type ActionType int
+type EndReason int
+type TimeoutAction int
 type Time int64     // Epoch time measured in seconds
 type Duration int64 // measured in seconds
 
@@ -10,6 +14,37 @@ const (
     AI    SeatType = 1
 )
 
+// Strength of the AI playing an AI seat
+const (
+    Easy   Difficulty = 0
+    Medium Difficulty = 1
+    Hard   Difficulty = 2
+    Expert Difficulty = 3
+)
+
+// Things a player may do in a game besides placing a stone
+const (
+    Resign      ActionType = 0
+    OfferDraw   ActionType = 1
+    AcceptDraw  ActionType = 2
+    DeclineDraw ActionType = 3
+    Abandon     ActionType = 4  // Leave the seat to an AI
+)
+
+// How a game ended
+const (
+    Played     EndReason = 0  // A line, enough captures, or a full board
+    Resigned   EndReason = 1
+    DrawAgreed EndReason = 2
+    TimedOut   EndReason = 3
+)
+
+// What happens when a seat runs out of time
+const (
+    Forfeit  TimeoutAction = 0  // The seat leaves play; the last seat left wins
+    SkipTurn TimeoutAction = 1  // The seat's turn passes without a stone
+)
+
 
 // Json Types
 type GameBoard struct {
@@ -24,9 +59,35 @@ type GameRules struct {
     CaptureSize   int  `json:"captureSize"`
     WinningNumCaptures int `json:"winningNumCaptures"`
 }
+// All times are in seconds. `PerMove` limits each move, and `Bank` gives each
+//  seat a total which grows by `Increment` after each of its turns. Zero turns
+//  either limit off, so the zero value is no clock at all.
+type TimeControl struct {
+    PerMove int             `json:"perMove"`
+    Bank int                `json:"bank"`
+    Increment int           `json:"increment"`
+    OnTimeout TimeoutAction `json:"onTimeout"`
+}
 type GameSpec struct {
-    Board GameBoard `json:"board"`
-    Rules GameRules `json:"rules"`
+    Board GameBoard   `json:"board"`
+    Rules GameRules   `json:"rules"`
+    Clock TimeControl `json:"clock"`
+}
+type Position struct {
+    X int   `json:"col"`
+    Y int   `json:"row"`
+}
+// `Board` is accessed as Board[row][column] and holds -1 for empty cells.
+//
+// In games with a clock, `Deadline` is when the current turn times out, and
+//  `Banks` holds each seat's bank as of the start of the turn.
+type GameState struct {
+    Player int      `json:"player"`
+    Turn int        `json:"turn"`
+    Board [][]int   `json:"board"`
+    Captures []int  `json:"captures"`
+    Deadline Time   `json:"deadline,omitempty"`
+    Banks []int     `json:"banks,omitempty"`
 }
 
 
@@ -38,6 +99,10 @@ type Game struct {
     Name string
     Password string
     Timestamp Time
+    RematchID ID  // 0 until a rematch of this game is created
+    BegunAt Time  // 0 until the game begins
+    HostID ID     // The player ID of the game's creator, or 0 if none
+    Locked bool   // Set by the host to stop anyone else from joining
 }
 type Spec struct {
     ID ID
@@ -47,6 +112,13 @@ type Spec struct {
 type Player struct {
     ID ID
     GameID ID
+    UserID ID  // 0 unless a signed-in user holds this player ID
+}
+// May watch a game (read moves, state, etc.) but not play in it
+type Spectator struct {
+    ID ID
+    GameID ID
+    Timestamp Time
 }
 type Seat struct {
     ID uint
@@ -55,6 +127,14 @@ type Seat struct {
     Type SeatType
     Claimed bool
     PlayerID ID
+    Difficulty Difficulty  // Only meaningful for AI seats
+    UserID ID              // 0 unless a signed-in user occupies the seat
+    DisplayName string     // Shown to the other players; may be empty
+    // Until `ReservedUntil`, only the player with ID `ReservedFor` from the
+    //  previous game may claim this seat of a rematch
+    ReservedFor ID
+    ReservedUntil Time
+    LastSeen Time  // The seat's latest heartbeat, or 0 if it has sent none
 }
 type Move struct {
     ID uint
@@ -62,4 +142,41 @@ type Move struct {
     Turn int
     X int
     Y int
+    Timestamp Time
+}
+type GameAction struct {
+    ID uint
+    GameID ID
+    Seat int
+    Action ActionType
+    Turn int       // The turn which was next when the action was taken
+    Timestamp Time
+}
+type ChatMessage struct {
+    ID uint
+    GameID ID
+    Seat int      // The sender's seat
+    Text string
+    Timestamp Time
+}
+type User struct {
+    ID ID
+    Username string
+    PasswordHash string
+    Salt string
+    Timestamp Time
+}
+// Only the hash of a session's token is stored
+type Session struct {
+    TokenHash string
+    UserID ID
+    Expires Time
+}
+type Result struct {
+    GameID ID
+    Winner int       // The winning seat, or -1 for a draw
+    Line []Position  // Empty unless the game was won by forming a line
+    Turn int         // The turn on which the game ended
+    Timestamp Time
+    Reason EndReason
 }